@@ -0,0 +1,64 @@
+package sqlite3perf
+
+import (
+	"database/sql"
+	"log"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// AnalyzeFileCmd is the struct representing analyze-file sub-command.
+type AnalyzeFileCmd struct {
+	Objects bool
+}
+
+// nolint:gochecknoinits
+func init() {
+	c := AnalyzeFileCmd{}
+	cmd := &cobra.Command{
+		Use:   "analyze-file",
+		Short: "analyze the space usage and fragmentation of the database file",
+		Long: `This command reports the page size, page count and freelist count of the SQLite database file,
+and the pages, fragmented leaf pages and fill factor of each table and index from the dbstat virtual table,
+to see how much a workload fragmented the file and what VACUUM recovered.`,
+		Run: c.run,
+	}
+
+	rootCmd.AddCommand(cmd)
+	c.initFlags(cmd.Flags())
+}
+
+func (g *AnalyzeFileCmd) initFlags(f *pflag.FlagSet) {
+	f.BoolVar(&g.Objects, "objects", true,
+		"report the page usage of each table and index by dbstat, skipped with a warning when not compiled in")
+}
+
+func (g *AnalyzeFileCmd) run(cmd *cobra.Command, args []string) {
+	if d := DriverDialect(driverName); d != SQLite {
+		log.Fatalf("analyze-file is only supported by %s, not %s", SQLite, d)
+	}
+
+	db := setupBench(false, 1)
+	defer db.Close()
+
+	s, err := g.collect(db)
+	if err != nil {
+		log.Fatalf("analyze %s error: %v", dbPath, err)
+	}
+
+	s.Print(os.Stdout)
+}
+
+// collect collects the file stats, without the page usage of each table and index if dbstat is not available.
+func (g *AnalyzeFileCmd) collect(db *sql.DB) (FileStats, error) {
+	s, err := CollectFileStats(db, g.Objects)
+	if err != nil && g.Objects {
+		// The dbstat virtual table is not compiled in by default, e.g. in github.com/mattn/go-sqlite3.
+		log.Printf("Warning: %v, reporting without the page usage of each table and index", err)
+		return CollectFileStats(db, false)
+	}
+
+	return s, err
+}
@@ -0,0 +1,231 @@
+package sqlite3perf
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Methods of the backup.
+const (
+	// BackupAPI copies the pages by the online backup API, https://www.sqlite.org/backup.html.
+	BackupAPI = "api"
+	// BackupVacuumInto writes a vacuumed copy by VACUUM INTO, https://www.sqlite.org/lang_vacuum.html#vacuuminto.
+	BackupVacuumInto = "vacuum-into"
+)
+
+// BackupCmd is the struct representing backup sub-command.
+type BackupCmd struct {
+	Method string
+	// To is the backup file, default <db>-backup.<ext>.
+	To string
+	// Restore restores the database from the backup file instead, by the online backup API.
+	Restore string
+	// PagesPerStep is the pages copied in each step of the online backup API, -1 for all the pages at once.
+	PagesPerStep int
+	// Sleep is the sleep between the steps of the online backup API, to let the writers go.
+	Sleep time.Duration
+	// Baseline is the duration to measure the concurrent workload before the backup.
+	Baseline time.Duration
+
+	workload ConcurrentCmd
+}
+
+// nolint:gochecknoinits
+func init() {
+	c := BackupCmd{}
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "backup the database hot, optionally with concurrent reads and writes",
+		Long: `This command copies the database by the online backup API of SQLite (mattn/go-sqlite3 only),
+or by VACUUM INTO, and measures the total time, and its impact on the concurrent reads and writes
+of the bench table when --writes or --reads are set.
+
+e.g. sqlite3perf backup --pages 100 --sleep 10ms --writes 4 --baseline 5s
+     sqlite3perf backup --method vacuum-into --writes 4
+     sqlite3perf backup --restore a-backup.db
+`,
+		Run: c.run,
+	}
+
+	rootCmd.AddCommand(cmd)
+	c.initFlags(cmd.Flags())
+}
+
+func (g *BackupCmd) initFlags(f *pflag.FlagSet) {
+	f.StringVar(&g.Method, "method", BackupAPI, "api: online backup API, vacuum-into: VACUUM INTO")
+	f.StringVar(&g.To, "to", "", "backup file, default <db>-backup.<ext>")
+	f.StringVar(&g.Restore, "restore", "", "backup file to restore the database from by the online backup API")
+	f.IntVar(&g.PagesPerStep, "pages", 100, "pages per step of the online backup API, -1 for all at once")
+	f.DurationVar(&g.Sleep, "sleep", 0, "sleep between the steps of the online backup API")
+	f.DurationVar(&g.Baseline, "baseline", 3*time.Second,
+		"duration to measure the concurrent workload before the backup, 0 to skip")
+	f.IntVarP(&g.workload.reads, "reads", "r", 0, "number of goroutines to read concurrently")
+	f.IntVarP(&g.workload.writes, "writes", "w", 0, "number of goroutines to write concurrently")
+	f.IntVarP(&g.workload.maxConns, "maxConns", "m", 0, "max of open connections to db, 0 for unlimited")
+	g.workload.conflict.Mode = ConflictPlain
+}
+
+func (g *BackupCmd) run(cmd *cobra.Command, args []string) {
+	log.Printf("Backup by config %+v", g)
+
+	if d := DriverDialect(driverName); d != SQLite {
+		log.Fatalf("backup is only supported by %s, not %s", SQLite, d)
+	}
+
+	if (g.Method == BackupAPI || g.Restore != "") && driverName != "sqlite3" {
+		log.Fatalf("online backup API is only supported by the sqlite3 driver(mattn/go-sqlite3), try --method %s",
+			BackupVacuumInto)
+	}
+
+	// A step of 0 pages copies nothing, and never finishes.
+	if g.PagesPerStep == 0 || g.PagesPerStep < -1 {
+		log.Fatalf("--pages %d should be positive, or -1 for all at once", g.PagesPerStep)
+	}
+
+	db := setupBench(false, g.workload.maxConns)
+	defer db.Close()
+
+	ctx := cmd.Context()
+
+	if g.Restore != "" {
+		if g.workload.reads+g.workload.writes > 0 {
+			log.Fatal("concurrent reads and writes are not supported when restoring")
+		}
+
+		g.restore(ctx, db)
+
+		return
+	}
+
+	to := g.To
+	if to == "" {
+		to = suffixDBPath(dbFile(), "-backup")
+	}
+
+	workload := g.workload.reads+g.workload.writes > 0
+	baseline := 0.0
+
+	if workload {
+		if err := db.QueryRow("SELECT COALESCE(MAX(ID), 0) FROM bench").Scan(&g.workload.from); err != nil {
+			log.Fatalf("query max ID of bench error: %v", err)
+		}
+
+		stop := g.workload.start(ctx, db)
+		defer stop()
+
+		if g.Baseline > 0 {
+			baseline = g.writeRate(ctx, func() { SleepContext(ctx, g.Baseline) })
+			log.Printf("Concurrent writes before backup: %.2f rows/s", baseline)
+		}
+	}
+
+	backup := func() { g.backup(ctx, db, to) }
+	if !workload {
+		backup()
+		return
+	}
+
+	during := g.writeRate(ctx, backup)
+	if baseline > 0 {
+		log.Printf("Concurrent writes during backup: %.2f rows/s(%+.2f%% of %.2f rows/s before)",
+			during, 100*(during-baseline)/baseline, baseline)
+	} else {
+		log.Printf("Concurrent writes during backup: %.2f rows/s", during)
+	}
+}
+
+// writeRate returns the rate of the concurrent writes while running fn.
+func (g *BackupCmd) writeRate(ctx context.Context, fn func()) float64 {
+	start, w := time.Now(), g.workload.written()
+	fn()
+
+	if ctx.Err() != nil {
+		log.Fatal(ctx.Err())
+	}
+
+	return float64(g.workload.written()-w) / time.Since(start).Seconds()
+}
+
+func (g *BackupCmd) backup(ctx context.Context, db *sql.DB, to string) {
+	log.Printf("Backup %s to %s by %s", dbFile(), to, g.Method)
+
+	start := time.Now()
+
+	switch g.Method {
+	case BackupAPI:
+		dest := openBackupFile(to)
+		defer dest.Close()
+
+		g.copyPages(ctx, dest, db)
+	case BackupVacuumInto:
+		// VACUUM INTO fails if the file already exists and is not empty.
+		removeDBFiles(to)
+
+		if _, err := db.ExecContext(ctx, "VACUUM INTO '"+strings.ReplaceAll(to, "'", "''")+"'"); err != nil {
+			log.Fatalf("VACUUM INTO %s error: %v", to, err)
+		}
+	default:
+		log.Fatalf("unknown backup method %s", g.Method)
+	}
+
+	size := int64(0)
+	if fi, err := os.Stat(to); err == nil {
+		size = fi.Size()
+	}
+
+	log.Printf("Backup to %s(%s) took %s", to, humanBytes(size), time.Since(start))
+}
+
+func (g *BackupCmd) restore(ctx context.Context, db *sql.DB) {
+	log.Printf("Restore %s from %s", dbFile(), g.Restore)
+
+	if _, err := os.Stat(g.Restore); err != nil {
+		log.Fatalf("backup file %s error: %v", g.Restore, err)
+	}
+
+	src := openBackupFile(g.Restore)
+	defer src.Close()
+
+	start := time.Now()
+	g.copyPages(ctx, db, src)
+	log.Printf("Restore from %s took %s", g.Restore, time.Since(start))
+}
+
+func openBackupFile(file string) *sql.DB {
+	db, err := sql.Open("sqlite3", file)
+	if err != nil {
+		log.Fatalf("Error while opening database '%s': %v", file, err)
+	}
+
+	return db
+}
+
+// copyPages copies the main database of src to dest by the online backup API.
+func (g *BackupCmd) copyPages(ctx context.Context, dest, src *sql.DB) {
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer destConn.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer srcConn.Close()
+
+	if err := destConn.Raw(func(d interface{}) error {
+		return srcConn.Raw(func(s interface{}) error {
+			return g.backupConns(ctx, d, s)
+		})
+	}); err != nil {
+		log.Fatalf("backup error: %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+//go:build cgo
+
+package sqlite3perf
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// backupConns copies the main database of the driver connection src to dest by the online backup API.
+func (g *BackupCmd) backupConns(ctx context.Context, dest, src interface{}) error {
+	dc, ok1 := dest.(*sqlite3.SQLiteConn)
+	sc, ok2 := src.(*sqlite3.SQLiteConn)
+
+	if !ok1 || !ok2 {
+		return fmt.Errorf("online backup API requires the connections of mattn/go-sqlite3")
+	}
+
+	return g.steps(ctx, dc, sc)
+}
+
+// steps copies PagesPerStep pages each step with Sleep between until done. The backup restarts
+// when the source is written by the other connections, which is counted by the remaining pages increased.
+func (g *BackupCmd) steps(ctx context.Context, dest, src *sqlite3.SQLiteConn) error {
+	b, err := dest.Backup("main", src, "main")
+	if err != nil {
+		return err
+	}
+
+	steps, restarts, lastRemaining := 0, 0, -1
+	lastLog := time.Now()
+
+	for {
+		done, err := b.Step(g.PagesPerStep)
+		if err != nil {
+			_ = b.Finish()
+			return err
+		}
+
+		steps++
+
+		if done {
+			break
+		}
+
+		remaining := b.Remaining()
+		if lastRemaining >= 0 && remaining > lastRemaining {
+			restarts++
+		}
+
+		lastRemaining = remaining
+
+		if time.Since(lastLog) >= 2*time.Second {
+			log.Printf("%d/%d pages remaining after %d steps", remaining, b.PageCount(), steps)
+			lastLog = time.Now()
+		}
+
+		if g.Sleep > 0 && SleepContext(ctx, g.Sleep) && ctx.Err() != nil {
+			_ = b.Finish()
+			return ctx.Err()
+		}
+	}
+
+	log.Printf("Copied %d pages in %d steps of %d pages, restarted %d times by the concurrent writes",
+		b.PageCount(), steps, g.PagesPerStep, restarts)
+
+	return b.Finish()
+}
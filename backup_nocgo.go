@@ -0,0 +1,13 @@
+//go:build !cgo
+
+package sqlite3perf
+
+import (
+	"context"
+	"errors"
+)
+
+// backupConns fails, the online backup API of mattn/go-sqlite3 is not available without cgo.
+func (g *BackupCmd) backupConns(context.Context, interface{}, interface{}) error {
+	return errors.New("backup requires cgo, try --method vacuum-into")
+}
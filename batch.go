@@ -0,0 +1,292 @@
+package sqlite3perf
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// BatchWriter inserts the records in multi-rows batches, within transactions of TxSize records.
+type BatchWriter struct {
+	BatchSize int
+	TxSize    int
+	// BeforeCommit is called in the transaction before it is committed, e.g. to save a checkpoint with the records.
+	BeforeCommit func(tx *sql.Tx) error
+
+	db       *sql.DB
+	t        Table
+	d        Dialect
+	conflict string
+	fields   int
+	// batchSize is the batch size requested, adjusted again when the columns added.
+	batchSize int
+	// columns are the columns inserted by their lower cased names.
+	columns map[string]Column
+
+	stmt    *sql.Stmt
+	tx      *sql.Tx
+	txStmt  *sql.Stmt
+	args    []interface{}
+	batched int
+	txRows  int
+	// committed is the number of the committed records.
+	committed int64
+}
+
+// NewBatchWriter creates a BatchWriter of the table, with the batch size adjusted to the max placeholders.
+// The table without columns is prepared when the columns added by AddColumns.
+func NewBatchWriter(db *sql.DB, t Table, conflict string, batchSize, txSize int) (*BatchWriter, error) {
+	w := &BatchWriter{
+		BatchSize: batchSize,
+		TxSize:    txSize,
+		db:        db,
+		t:         t,
+		d:         DriverDialect(driverName),
+		conflict:  conflict,
+		batchSize: batchSize,
+	}
+
+	if len(t.Columns) == 0 {
+		return w, nil
+	}
+
+	return w, w.prepare()
+}
+
+// prepare prepares the insert statement of the columns of the table.
+func (w *BatchWriter) prepare() error {
+	w.fields = w.t.InsertFieldsNum()
+	w.BatchSize = adjustBatchSize(w.db, w.d, w.batchSize, w.fields)
+
+	w.columns = make(map[string]Column, w.fields)
+	for _, c := range w.t.InsertColumns() {
+		w.columns[strings.ToLower(c.Name)] = c
+	}
+
+	query := w.t.CreateInsertSQL(w.d, w.conflict, w.BatchSize)
+	stmt, err := w.db.Prepare(query)
+	if err != nil {
+		return fmt.Errorf("prepare len:%d query %s: %w", len(query), abbreviate(query, 1000), err)
+	}
+
+	if w.stmt != nil {
+		_ = w.stmt.Close()
+	}
+
+	w.stmt = stmt
+	w.args = make([]interface{}, 0, w.BatchSize*w.fields)
+
+	return nil
+}
+
+// Column returns the column inserted of the name, case-insensitively.
+func (w *BatchWriter) Column(name string) (Column, bool) {
+	c, ok := w.columns[strings.ToLower(name)]
+	return c, ok
+}
+
+// AddColumns inserts the batched records and commits them, adds the columns to the table by EvolveTable,
+// or creates the table, and prepares the insert statement of the columns again.
+func (w *BatchWriter) AddColumns(ctx context.Context, columns ...Column) error {
+	if err := w.Flush(ctx); err != nil {
+		return err
+	}
+
+	t := w.t
+	t.Columns = append(append([]Column(nil), t.Columns...), columns...)
+
+	if _, err := EvolveTable(w.db, t, schema, false); err != nil {
+		return err
+	}
+
+	w.t = t
+
+	return w.prepare()
+}
+
+// WidenColumns inserts the batched records and commits them, changes the types of the columns of the same names,
+// and prepares the insert statement of the columns again.
+func (w *BatchWriter) WidenColumns(ctx context.Context, columns ...Column) error {
+	if err := w.Flush(ctx); err != nil {
+		return err
+	}
+
+	t := w.t
+	t.Columns = append([]Column(nil), t.Columns...)
+
+	for _, c := range columns {
+		if err := alterColumnType(w.db, w.d, t.Name, c); err != nil {
+			return err
+		}
+
+		for i := range t.Columns {
+			if strings.EqualFold(t.Columns[i].Name, c.Name) {
+				t.Columns[i] = c
+			}
+		}
+	}
+
+	w.t = t
+
+	return w.prepare()
+}
+
+// AddRecord adds the record of the values by the column names, the missing ones as NULL.
+func (w *BatchWriter) AddRecord(ctx context.Context, values map[string]interface{}) error {
+	if w.stmt == nil {
+		return fmt.Errorf("no columns of the table %s to insert", w.t.Name)
+	}
+
+	for _, c := range w.t.InsertColumns() {
+		w.args = append(w.args, values[c.Name])
+	}
+
+	return w.added(ctx)
+}
+
+// adjustBatchSize adjusts the batch size to the max placeholders of the database.
+func adjustBatchSize(db *sql.DB, d Dialect, batchSize, fields int) int {
+	max, from := d.DetectMaxPlaceholders(db)
+	if batchSize*fields > max {
+		log.Printf("adjust batch size from %d to %d, %d fields per record with max %d placeholders by %s",
+			batchSize, max/fields, fields, max, from)
+		return max / fields
+	}
+
+	log.Printf("batch size %d, %d fields per record with max %d placeholders by %s", batchSize, fields, max, from)
+
+	return batchSize
+}
+
+// Add adds a record, inserts the batch when full, and commits the transaction when TxSize records inserted.
+func (w *BatchWriter) Add(ctx context.Context, record ...interface{}) error {
+	w.args = append(w.args, record...)
+
+	return w.added(ctx)
+}
+
+// added inserts the batch when full, and commits the transaction when TxSize records inserted.
+func (w *BatchWriter) added(ctx context.Context) error {
+	if w.batched++; w.batched < w.BatchSize {
+		return nil
+	}
+
+	if err := w.exec(ctx, w.stmt, w.args); err != nil {
+		return err
+	}
+
+	if w.TxSize > 0 && w.txRows >= w.TxSize {
+		return w.commit()
+	}
+
+	return nil
+}
+
+// Flush inserts the partial batch and commits the transaction.
+func (w *BatchWriter) Flush(ctx context.Context) error {
+	if w.batched > 0 {
+		if err := w.exec(ctx, nil, w.args); err != nil {
+			return err
+		}
+	}
+
+	return w.commit()
+}
+
+// Close flushes and releases the prepared statement.
+func (w *BatchWriter) Close(ctx context.Context) error {
+	if w.stmt != nil {
+		defer w.stmt.Close()
+	}
+
+	return w.Flush(ctx)
+}
+
+// Committed returns the number of the committed records.
+func (w *BatchWriter) Committed() int64 { return w.committed }
+
+// exec executes the statement in the transaction, which begins lazily. The nil statement is the partial batch,
+// which is prepared in the transaction, because the pool may have the only connection held by the transaction.
+func (w *BatchWriter) exec(ctx context.Context, stmt *sql.Stmt, args []interface{}) error {
+	if err := w.begin(ctx); err != nil {
+		return err
+	}
+
+	s := w.txStmt
+	if stmt == nil {
+		query := w.t.CreateInsertSQL(w.d, w.conflict, w.batched)
+		partial, err := w.tx.PrepareContext(ctx, query)
+		if err != nil {
+			return fmt.Errorf("prepare len:%d query %s: %w", len(query), abbreviate(query, 1000), err)
+		}
+		defer partial.Close()
+
+		s = partial
+	}
+
+	if _, err := s.ExecContext(ctx, args...); err != nil {
+		return fmt.Errorf("insert %d records into %s: %w", w.batched, w.t.Name, err)
+	}
+
+	w.txRows += w.batched
+	w.args, w.batched = w.args[:0], 0
+
+	return nil
+}
+
+// Exec executes the query in the current transaction, e.g. to insert the rows committed together with the records.
+func (w *BatchWriter) Exec(ctx context.Context, query string, args ...interface{}) error {
+	if err := w.begin(ctx); err != nil {
+		return err
+	}
+
+	_, err := w.tx.ExecContext(ctx, query, args...)
+
+	return err
+}
+
+// begin begins the transaction if not yet.
+func (w *BatchWriter) begin(ctx context.Context) error {
+	if w.tx != nil {
+		return nil
+	}
+
+	tx, err := w.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	w.tx, w.txStmt = tx, nil
+	if w.stmt != nil {
+		w.txStmt = tx.StmtContext(ctx, w.stmt)
+	}
+
+	return nil
+}
+
+func (w *BatchWriter) commit() error {
+	if w.tx == nil {
+		return nil
+	}
+
+	tx := w.tx
+	w.tx = nil
+
+	if w.BeforeCommit != nil {
+		if err := w.BeforeCommit(tx); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit %d records into %s: %w", w.txRows, w.t.Name, err)
+	}
+
+	w.committed += int64(w.txRows)
+	w.txRows = 0
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package sqlite3perf
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func TestAdjustBatchSize(t *testing.T) {
+	tests := []struct {
+		name              string
+		driver            string
+		batchSize, fields int
+		want              int
+	}{
+		{name: "within the legacy limit", driver: "sqlite3", batchSize: 99, fields: 10, want: 99},
+		{name: "over the legacy limit", driver: "sqlite3", batchSize: 100, fields: 10, want: 99},
+		{name: "over the legacy limit by a field", driver: "sqlite3", batchSize: 1000, fields: 1, want: 999},
+		{name: "within the limit of modernc", driver: "sqlite", batchSize: 1000, fields: 10, want: 1000},
+		{name: "over the limit of modernc", driver: "sqlite", batchSize: 4000, fields: 10, want: 3276},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := sql.Open(tt.driver, ":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			got := adjustBatchSize(db, SQLite, tt.batchSize, tt.fields)
+			if got != tt.want {
+				t.Errorf("adjustBatchSize(%d, %d) = %d, want %d", tt.batchSize, tt.fields, got, tt.want)
+			}
+
+			// The statement of the batch adjusted is prepared.
+			values := "(" + strings.Repeat(",?", tt.fields)[1:] + ")"
+			query := "SELECT * FROM (VALUES" + strings.Repeat(","+values, got)[1:] + ")"
+
+			ps, err := db.Prepare(query)
+			if err != nil {
+				t.Fatalf("prepare the batch of %d records: %v", got, err)
+			}
+
+			_ = ps.Close()
+		})
+	}
+}
@@ -4,9 +4,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
-	"fmt"
 	"log"
-	"os"
 	"sync/atomic"
 	"time"
 
@@ -43,13 +41,15 @@ func init() {
 func benchRun(cmd *cobra.Command, args []string) {
 	log.Print("Running benchmark")
 
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		fmt.Printf("Error while opening database '%s': %s", dbPath, err.Error())
-		os.Exit(1)
-	}
+	db := setupBench(false, 0)
 	defer db.Close()
 
+	runBench(db)
+}
+
+// runBench retrieves and verifies all the records in the bench table,
+// and returns the number of rows and the elapsed time.
+func runBench(db *sql.DB) (totalRows int64, e time.Duration) {
 	var (
 		ID   int64
 		rand string
@@ -110,11 +110,11 @@ func benchRun(cmd *cobra.Command, args []string) {
 			log.Fatal("Hash of original value and persist hash do not match!")
 		}
 	}
-	e := time.Since(start)
+	e = time.Since(start)
 	el := time.Since(l)
 	done <- true
 
-	totalRows := atomic.LoadInt64(&c)
+	totalRows = atomic.LoadInt64(&c)
 	log.Printf("%d rows processed", totalRows)
 	log.Printf("Finished loop after %s", el)
 
@@ -127,4 +127,6 @@ func benchRun(cmd *cobra.Command, args []string) {
 		duration := time.Duration(e.Nanoseconds() / totalRows)
 		log.Printf("Average %s per record, %s overall", duration, e)
 	}
+
+	return totalRows, e
 }
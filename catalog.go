@@ -0,0 +1,267 @@
+package sqlite3perf
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Types of the PRAGMA values.
+const (
+	// PragmaNoValue PRAGMAs can only be queried or run, not assigned.
+	PragmaNoValue = "none"
+	PragmaBool    = "bool"
+	PragmaInt     = "int"
+	PragmaEnum    = "enum"
+)
+
+// Scopes of the PRAGMA settings.
+const (
+	// PragmaConnection settings are lost when the connection is closed, e.g. reconnected by the pool.
+	PragmaConnection = "per-connection"
+	// PragmaPersistent settings are stored in the database file.
+	PragmaPersistent = "persistent"
+	// PragmaProcess settings are shared by all the connections of the process.
+	PragmaProcess = "process-wide"
+	// PragmaReadOnly PRAGMAs only report information.
+	PragmaReadOnly = "read-only"
+	// PragmaAction PRAGMAs do some work, like checks, checkpoints or vacuums.
+	PragmaAction = "action"
+)
+
+// Usages of the PRAGMA arguments like table_info(bench).
+const (
+	ArgNone     = 0
+	ArgOptional = 1
+	ArgRequired = 2
+)
+
+// PragmaInfo describes a known PRAGMA.
+type PragmaInfo struct {
+	Type  string
+	Scope string
+	// Enum maps the names of the enumerated values to the values returned by querying them.
+	Enum map[string]string
+	Arg  int
+	// Note is the caveat of the PRAGMA, like when it takes effect.
+	Note string
+}
+
+func (i PragmaInfo) String() string {
+	s := i.Scope
+	if i.Note != "" {
+		s += ", " + i.Note
+	}
+
+	return s
+}
+
+// pragmaCatalog is the catalog of the known PRAGMAs, see https://www.sqlite.org/pragma.html.
+// nolint:gochecknoglobals
+var pragmaCatalog = map[string]PragmaInfo{
+	"application_id": {Type: PragmaInt, Scope: PragmaPersistent},
+	"auto_vacuum": {
+		Type: PragmaEnum, Scope: PragmaPersistent,
+		Enum: map[string]string{"NONE": "0", "FULL": "1", "INCREMENTAL": "2", "0": "0", "1": "1", "2": "2"},
+		Note: "takes effect only before the first table is created or after VACUUM",
+	},
+	"automatic_index":      {Type: PragmaBool, Scope: PragmaConnection},
+	"busy_timeout":         {Type: PragmaInt, Scope: PragmaConnection},
+	"cache_size":           {Type: PragmaInt, Scope: PragmaConnection},
+	"cache_spill":          {Type: PragmaInt, Scope: PragmaConnection},
+	"case_sensitive_like":  {Type: PragmaBool, Scope: PragmaConnection, Note: "can not be queried"},
+	"cell_size_check":      {Type: PragmaBool, Scope: PragmaConnection},
+	"checkpoint_fullfsync": {Type: PragmaBool, Scope: PragmaConnection},
+	"collation_list":       {Type: PragmaNoValue, Scope: PragmaReadOnly},
+	"compile_options":      {Type: PragmaNoValue, Scope: PragmaReadOnly},
+	"data_version":         {Type: PragmaNoValue, Scope: PragmaReadOnly},
+	"database_list":        {Type: PragmaNoValue, Scope: PragmaReadOnly},
+	"defer_foreign_keys":   {Type: PragmaBool, Scope: PragmaConnection},
+	"encoding": {
+		Type: PragmaEnum, Scope: PragmaPersistent,
+		Enum: map[string]string{"UTF-8": "UTF-8", "UTF-16": "UTF-16", "UTF-16LE": "UTF-16le", "UTF-16BE": "UTF-16be"},
+		Note: "takes effect only before the database is created",
+	},
+	"foreign_key_check":        {Type: PragmaNoValue, Scope: PragmaAction, Arg: ArgOptional},
+	"foreign_key_list":         {Type: PragmaNoValue, Scope: PragmaReadOnly, Arg: ArgRequired},
+	"foreign_keys":             {Type: PragmaBool, Scope: PragmaConnection},
+	"freelist_count":           {Type: PragmaNoValue, Scope: PragmaReadOnly},
+	"fullfsync":                {Type: PragmaBool, Scope: PragmaConnection},
+	"hard_heap_limit":          {Type: PragmaInt, Scope: PragmaProcess},
+	"ignore_check_constraints": {Type: PragmaBool, Scope: PragmaConnection},
+	"incremental_vacuum":       {Type: PragmaNoValue, Scope: PragmaAction, Arg: ArgOptional},
+	"index_info":               {Type: PragmaNoValue, Scope: PragmaReadOnly, Arg: ArgRequired},
+	"index_list":               {Type: PragmaNoValue, Scope: PragmaReadOnly, Arg: ArgRequired},
+	"index_xinfo":              {Type: PragmaNoValue, Scope: PragmaReadOnly, Arg: ArgRequired},
+	"integrity_check":          {Type: PragmaNoValue, Scope: PragmaAction, Arg: ArgOptional},
+	"journal_mode": {
+		Type: PragmaEnum, Scope: PragmaConnection,
+		Enum: map[string]string{
+			"DELETE": "delete", "TRUNCATE": "truncate", "PERSIST": "persist",
+			"MEMORY": "memory", "WAL": "wal", "OFF": "off",
+		},
+		Note: "WAL is persistent",
+	},
+	"journal_size_limit": {Type: PragmaInt, Scope: PragmaConnection},
+	"legacy_alter_table": {Type: PragmaBool, Scope: PragmaConnection},
+	"locking_mode": {
+		Type: PragmaEnum, Scope: PragmaConnection,
+		Enum: map[string]string{"NORMAL": "normal", "EXCLUSIVE": "exclusive"},
+	},
+	"max_page_count": {Type: PragmaInt, Scope: PragmaConnection},
+	"mmap_size":      {Type: PragmaInt, Scope: PragmaConnection},
+	"optimize":       {Type: PragmaNoValue, Scope: PragmaAction, Arg: ArgOptional},
+	"page_count":     {Type: PragmaNoValue, Scope: PragmaReadOnly},
+	"page_size": {
+		Type: PragmaInt, Scope: PragmaPersistent,
+		Note: "takes effect only before the database is created or after VACUUM",
+	},
+	"query_only":                {Type: PragmaBool, Scope: PragmaConnection},
+	"quick_check":               {Type: PragmaNoValue, Scope: PragmaAction, Arg: ArgOptional},
+	"read_uncommitted":          {Type: PragmaBool, Scope: PragmaConnection},
+	"recursive_triggers":        {Type: PragmaBool, Scope: PragmaConnection},
+	"reverse_unordered_selects": {Type: PragmaBool, Scope: PragmaConnection},
+	"secure_delete": {
+		Type: PragmaEnum, Scope: PragmaConnection,
+		Enum: map[string]string{"OFF": "0", "ON": "1", "FAST": "2", "FALSE": "0", "TRUE": "1", "0": "0", "1": "1", "2": "2"},
+	},
+	"shrink_memory":   {Type: PragmaNoValue, Scope: PragmaAction},
+	"soft_heap_limit": {Type: PragmaInt, Scope: PragmaProcess},
+	"synchronous": {
+		Type: PragmaEnum, Scope: PragmaConnection,
+		Enum: map[string]string{"OFF": "0", "NORMAL": "1", "FULL": "2", "EXTRA": "3", "0": "0", "1": "1", "2": "2", "3": "3"},
+	},
+	"table_info":  {Type: PragmaNoValue, Scope: PragmaReadOnly, Arg: ArgRequired},
+	"table_list":  {Type: PragmaNoValue, Scope: PragmaReadOnly, Arg: ArgOptional},
+	"table_xinfo": {Type: PragmaNoValue, Scope: PragmaReadOnly, Arg: ArgRequired},
+	"temp_store": {
+		Type: PragmaEnum, Scope: PragmaConnection,
+		Enum: map[string]string{"DEFAULT": "0", "FILE": "1", "MEMORY": "2", "0": "0", "1": "1", "2": "2"},
+	},
+	"threads":            {Type: PragmaInt, Scope: PragmaConnection},
+	"trusted_schema":     {Type: PragmaBool, Scope: PragmaConnection},
+	"user_version":       {Type: PragmaInt, Scope: PragmaPersistent},
+	"wal_autocheckpoint": {Type: PragmaInt, Scope: PragmaConnection},
+	"wal_checkpoint": {
+		Type: PragmaNoValue, Scope: PragmaAction, Arg: ArgOptional,
+		Enum: map[string]string{"PASSIVE": "", "FULL": "", "RESTART": "", "TRUNCATE": ""},
+	},
+}
+
+// nolint:gochecknoglobals
+var (
+	pragmaKeyRegexp = regexp.MustCompile(`^(?:(\w+)\.)?(\w+)(?:\(\s*(-?\w*)\s*\))?$`)
+	// pragmaValueRegexp is the syntax of the values of the unknown PRAGMAs, only run with force.
+	pragmaValueRegexp = regexp.MustCompile(`^[+-]?[\w.]+$`)
+)
+
+// Pragma is a parsed PRAGMA statement like main.table_info(bench) or journal_mode=WAL.
+type Pragma struct {
+	Schema string
+	Name   string
+	Arg    string
+	Value  string
+	Info   PragmaInfo
+	// Known tells whether the PRAGMA is in the catalog.
+	Known bool
+}
+
+// ParsePragma parses the PRAGMA of key[=value] and validates it against the catalog,
+// the unknown ones are rejected unless force, and the syntax is checked even if forced
+// so that the PRAGMA can not be abused to run other SQL. The trailing semicolons are ignored.
+func ParsePragma(p string, force bool) (Pragma, error) {
+	key, value := splitPragma(strings.TrimRight(p, "; \t\r\n"))
+
+	m := pragmaKeyRegexp.FindStringSubmatch(key)
+	if m == nil {
+		return Pragma{}, fmt.Errorf("invalid PRAGMA %q", p)
+	}
+
+	r := Pragma{Schema: m[1], Name: strings.ToLower(m[2]), Arg: m[3], Value: value}
+	r.Info, r.Known = pragmaCatalog[r.Name]
+
+	if !r.Known {
+		if !force {
+			return r, fmt.Errorf("unknown PRAGMA %s, force to run it anyway", r.Name)
+		}
+
+		if value != "" && !pragmaValueRegexp.MatchString(value) {
+			return r, fmt.Errorf("invalid value %q of PRAGMA %s", value, r.Name)
+		}
+
+		return r, nil
+	}
+
+	switch {
+	case r.Arg == "" && r.Info.Arg == ArgRequired:
+		return r, fmt.Errorf("PRAGMA %s requires an argument, like %s(name)", r.Name, r.Name)
+	case r.Arg != "" && r.Info.Arg == ArgNone:
+		return r, fmt.Errorf("PRAGMA %s takes no argument", r.Name)
+	case r.Arg != "" && r.Info.Enum != nil && r.Info.Type == PragmaNoValue:
+		if _, ok := r.Info.Enum[strings.ToUpper(r.Arg)]; !ok {
+			return r, fmt.Errorf("invalid argument %s of PRAGMA %s, should be one of %s",
+				r.Arg, r.Name, enumNames(r.Info.Enum))
+		}
+	}
+
+	if value == "" {
+		return r, nil
+	}
+
+	return r, r.validateValue()
+}
+
+func (p Pragma) validateValue() error {
+	switch p.Info.Type {
+	case PragmaNoValue:
+		return fmt.Errorf("PRAGMA %s(%s) can not be assigned", p.Name, p.Info.Scope)
+	case PragmaBool:
+		switch strings.ToLower(p.Value) {
+		case "0", "1", "on", "off", "true", "false", "yes", "no":
+			return nil
+		}
+
+		return fmt.Errorf("invalid value %s of PRAGMA %s, should be a boolean like on/off", p.Value, p.Name)
+	case PragmaInt:
+		if _, err := strconv.ParseInt(p.Value, 10, 64); err != nil {
+			return fmt.Errorf("invalid value %s of PRAGMA %s, should be an integer", p.Value, p.Name)
+		}
+	case PragmaEnum:
+		if _, ok := p.Info.Enum[strings.ToUpper(p.Value)]; !ok {
+			return fmt.Errorf("invalid value %s of PRAGMA %s, should be one of %s",
+				p.Value, p.Name, enumNames(p.Info.Enum))
+		}
+	}
+
+	return nil
+}
+
+// Key returns the PRAGMA without the value, like main.table_info(bench).
+func (p Pragma) Key() string {
+	key := p.Name
+	if p.Schema != "" {
+		key = p.Schema + "." + key
+	}
+
+	if p.Arg != "" {
+		key += "(" + p.Arg + ")"
+	}
+
+	return key
+}
+
+// enumNames returns the names of the enumerated values which are not numbers.
+func enumNames(enum map[string]string) string {
+	var names []string
+	for name := range enum {
+		if _, err := strconv.Atoi(name); err != nil {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return strings.Join(names, "/")
+}
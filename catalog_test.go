@@ -0,0 +1,81 @@
+package sqlite3perf
+
+import "testing"
+
+func TestParsePragma(t *testing.T) {
+	tests := []struct {
+		name    string
+		pragma  string
+		force   bool
+		want    Pragma
+		wantErr bool
+	}{
+		{name: "query", pragma: "page_count", want: Pragma{Name: "page_count"}},
+		{name: "enum value", pragma: "journal_mode = WAL", want: Pragma{Name: "journal_mode", Value: "WAL"}},
+		{name: "enum value lower cased", pragma: "Journal_Mode=wal", want: Pragma{Name: "journal_mode", Value: "wal"}},
+		{name: "invalid enum value", pragma: "journal_mode=fast", wantErr: true},
+		{name: "bool value", pragma: "foreign_keys=on", want: Pragma{Name: "foreign_keys", Value: "on"}},
+		{name: "invalid bool value", pragma: "foreign_keys=2", wantErr: true},
+		{name: "int value", pragma: "user_version=-3", want: Pragma{Name: "user_version", Value: "-3"}},
+		{name: "invalid int value", pragma: "user_version=abc", wantErr: true},
+		{name: "read-only assigned", pragma: "page_count=3", wantErr: true},
+		{name: "schema and argument", pragma: "main.table_info(bench)",
+			want: Pragma{Schema: "main", Name: "table_info", Arg: "bench"}},
+		{name: "argument required", pragma: "table_info", wantErr: true},
+		{name: "argument not taken", pragma: "page_count(3)", wantErr: true},
+		{name: "optional argument", pragma: "integrity_check(10)", want: Pragma{Name: "integrity_check", Arg: "10"}},
+		{name: "enum argument", pragma: "wal_checkpoint(TRUNCATE)", want: Pragma{Name: "wal_checkpoint", Arg: "TRUNCATE"}},
+		{name: "invalid enum argument", pragma: "wal_checkpoint(ALL)", wantErr: true},
+		{name: "unknown", pragma: "made_up=1", wantErr: true},
+		{name: "unknown forced", pragma: "made_up=1", force: true, want: Pragma{Name: "made_up", Value: "1"}},
+		{name: "injection forced", pragma: "made_up=1; DROP TABLE bench", force: true, wantErr: true},
+		{name: "injection in key", pragma: "page_count; DROP TABLE bench", force: true, wantErr: true},
+		{name: "trailing semicolon", pragma: "journal_mode=WAL;", want: Pragma{Name: "journal_mode", Value: "WAL"}},
+		{name: "trailing semicolons and spaces", pragma: "cache_size = -64000 ; ; ",
+			want: Pragma{Name: "cache_size", Value: "-64000"}},
+		{name: "query with trailing semicolon", pragma: "page_count;", want: Pragma{Name: "page_count"}},
+		{name: "injection after semicolon", pragma: "journal_mode=WAL; DROP TABLE bench;", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePragma(tt.pragma, tt.force)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePragma(%q) error = %v, wantErr %v", tt.pragma, err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if got.Schema != tt.want.Schema || got.Name != tt.want.Name || got.Arg != tt.want.Arg ||
+				got.Value != tt.want.Value {
+				t.Errorf("ParsePragma(%q) = %+v, want %+v", tt.pragma, got, tt.want)
+			}
+
+			if got.Known == tt.force {
+				t.Errorf("ParsePragma(%q) known = %v", tt.pragma, got.Known)
+			}
+		})
+	}
+}
+
+func TestPragmaValueEquals(t *testing.T) {
+	tests := []struct {
+		name, set, got string
+		want           bool
+	}{
+		{name: "journal_mode", set: "WAL", got: "wal", want: true},
+		{name: "synchronous", set: "NORMAL", got: "1", want: true},
+		{name: "synchronous", set: "FULL", got: "1", want: false},
+		{name: "foreign_keys", set: "on", got: "1", want: true},
+		{name: "foreign_keys", set: "off", got: "1", want: false},
+		{name: "page_size", set: "8192", got: "4096", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := PragmaValueEquals(tt.name, tt.set, tt.got); got != tt.want {
+			t.Errorf("PragmaValueEquals(%s, %s, %s) = %v, want %v", tt.name, tt.set, tt.got, got, tt.want)
+		}
+	}
+}
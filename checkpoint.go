@@ -0,0 +1,168 @@
+package sqlite3perf
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// checkpointTable is the table of the offsets of the last committed records of the files imported by logline.
+func checkpointTable() Table {
+	return Table{
+		Name:    "logline_checkpoint",
+		Comment: "offsets of the last committed records of the files imported by logline",
+		Columns: []Column{
+			{Name: "id", Type: TypeVarchar, Size: 255, PrimaryKey: true, Comment: "table:inode, or table:path"},
+			{Name: "table_name", Type: TypeVarchar, Size: 64, NotNull: true},
+			{Name: "path", Type: TypeVarchar, Size: 1024, NotNull: true},
+			{Name: "inode", Type: TypeBigInt, NotNull: true},
+			{Name: "size", Type: TypeBigInt, NotNull: true, Comment: "file size when opened"},
+			{Name: "head_size", Type: TypeInt, NotNull: true},
+			{Name: "head_hash", Type: TypeVarchar, Size: 64, NotNull: true, Comment: "SHA-256 of the head"},
+			{Name: "committed_offset", Type: TypeBigInt, NotNull: true, Comment: "of the decompressed content"},
+			{Name: "updated", Type: TypeDatetime, NotNull: true},
+		},
+	}
+}
+
+// Checkpoints saves the offsets of the last committed records of the files, in the same transaction of the records,
+// to resume the imports of the files exactly where they stopped.
+type Checkpoints struct {
+	table string
+	t     Table
+	d     Dialect
+
+	mu sync.Mutex
+	// saved are the committed checkpoints by the keys.
+	saved map[string]checkpoint
+	// pending are the checkpoints of the records not committed yet by the keys.
+	pending map[string]checkpoint
+}
+
+type checkpoint struct {
+	FileID
+	Offset int64
+}
+
+// LoadCheckpoints loads the checkpoints of the table, and creates the checkpoint table if not exists.
+func LoadCheckpoints(db *sql.DB, table string) (*Checkpoints, error) {
+	c := &Checkpoints{
+		table:   table,
+		t:       checkpointTable(),
+		d:       DriverDialect(driverName),
+		saved:   make(map[string]checkpoint),
+		pending: make(map[string]checkpoint),
+	}
+
+	query := c.d.Rebind(`SELECT id, path, inode, size, head_size, head_hash, committed_offset FROM ` + c.t.Name +
+		` WHERE table_name = ?`)
+
+	rows, err := db.Query(query, table)
+	if err != nil {
+		// maybe not created yet.
+		createTable, err := c.t.CreateSQL(c.d, SchemaDefault)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("Create checkpoint table %s", c.t.Name)
+
+		if _, err := db.Exec(createTable); err != nil {
+			return nil, fmt.Errorf("create table %s: %w", createTable, err)
+		}
+
+		return c, nil
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			key   string
+			inode int64
+			cp    checkpoint
+		)
+
+		if err := rows.Scan(&key, &cp.Path, &inode, &cp.Size, &cp.HeadSize, &cp.HeadHash, &cp.Offset); err != nil {
+			return nil, err
+		}
+
+		cp.Inode = uint64(inode)
+		c.saved[key] = cp
+	}
+
+	return c, rows.Err()
+}
+
+func (c *Checkpoints) key(id FileID) string {
+	if id.Inode == 0 {
+		return c.table + ":" + id.Path
+	}
+
+	return c.table + ":" + strconv.FormatUint(id.Inode, 10)
+}
+
+// Resume returns the offset of the last committed record of the file, if the head of the file is the same
+// as the one checkpointed, even if it is renamed by the rotation, else 0.
+func (c *Checkpoints) Resume(f *os.File, id FileID) int64 {
+	c.mu.Lock()
+	cp, ok := c.saved[c.key(id)]
+	c.mu.Unlock()
+
+	if !ok {
+		return 0
+	}
+
+	if cp.HeadSize > id.HeadSize {
+		log.Printf("%s is smaller than the head of the checkpoint of %s, read from the start", id.Path, cp.Path)
+		return 0
+	}
+
+	if hash, err := headHash(f, cp.HeadSize); err != nil || hash != cp.HeadHash {
+		log.Printf("%s is not the same file of the checkpoint of %s, read from the start", id.Path, cp.Path)
+		return 0
+	}
+
+	log.Printf("Resume %s from offset %d by the checkpoint of %s", id.Path, cp.Offset, cp.Path)
+
+	return cp.Offset
+}
+
+// Mark marks the offset of the record of the file, to be saved when the record committed.
+func (c *Checkpoints) Mark(id FileID, offset int64) {
+	if id.HeadHash == "" { // stdin
+		return
+	}
+
+	c.mu.Lock()
+	c.pending[c.key(id)] = checkpoint{FileID: id, Offset: offset}
+	c.mu.Unlock()
+}
+
+// Save saves the marked checkpoints in the transaction, as the BatchWriter.BeforeCommit.
+func (c *Checkpoints) Save(tx *sql.Tx) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.pending) == 0 {
+		return nil
+	}
+
+	query := c.t.CreateInsertSQL(c.d, ConflictReplace, 1)
+	now := time.Now()
+
+	for key, cp := range c.pending {
+		if _, err := tx.Exec(query, key, c.table, cp.Path, int64(cp.Inode), cp.Size, cp.HeadSize, cp.HeadHash,
+			cp.Offset, now); err != nil {
+			return fmt.Errorf("save checkpoint of %s: %w", cp.Path, err)
+		}
+
+		c.saved[key] = cp
+		delete(c.pending, key)
+	}
+
+	return nil
+}
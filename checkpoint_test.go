@@ -0,0 +1,225 @@
+package sqlite3perf
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointsKey(t *testing.T) {
+	c := &Checkpoints{table: "t"}
+
+	tests := []struct {
+		id   FileID
+		want string
+	}{
+		{id: FileID{Path: "a.log", Inode: 123}, want: "t:123"},
+		{id: FileID{Path: "a.log"}, want: "t:a.log"},
+	}
+
+	for _, tt := range tests {
+		if got := c.key(tt.id); got != tt.want {
+			t.Errorf("key(%+v) = %s, want %s", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestCheckpointsResume(t *testing.T) {
+	const content = "line 1\nline 2\nline 3\n"
+
+	tests := []struct {
+		name string
+		// change changes the file after checkpointed, and returns the file to resume.
+		change func(t *testing.T, file string) string
+		want   int64
+	}{
+		{
+			name:   "unchanged",
+			change: func(t *testing.T, file string) string { return file },
+			want:   7,
+		},
+		{
+			name: "appended",
+			change: func(t *testing.T, file string) string {
+				writeFile(t, file, content+"line 4\n")
+				return file
+			},
+			want: 7,
+		},
+		{
+			name: "renamed by the rotation",
+			change: func(t *testing.T, file string) string {
+				if err := os.Rename(file, file+".1"); err != nil {
+					t.Fatal(err)
+				}
+
+				return file + ".1"
+			},
+			want: 7,
+		},
+		{
+			name: "head rewritten",
+			change: func(t *testing.T, file string) string {
+				writeFile(t, file, "LINE 1\nline 2\nline 3\n")
+				return file
+			},
+			want: 0,
+		},
+		{
+			name: "truncated smaller than the head",
+			change: func(t *testing.T, file string) string {
+				writeFile(t, file, "line 1\n")
+				return file
+			},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "a.log")
+			writeFile(t, file, content)
+
+			db := openTestDB(t, "sqlite3")
+
+			c, err := LoadCheckpoints(db, "t")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			c.Mark(openFileID(t, file), 7)
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := c.Save(tx); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+
+			resumed := tt.change(t, file)
+
+			// Loaded again as a new run.
+			if c, err = LoadCheckpoints(db, "t"); err != nil {
+				t.Fatal(err)
+			}
+
+			inputs, err := OpenInputs(context.Background(), resumed, InputOptions{Order: OrderName})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			inputs.Resume = c.Resume
+
+			in, err := inputs.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+
+			if in.Offset != tt.want {
+				t.Errorf("offset = %d, want %d", in.Offset, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckpointsSaveInTx(t *testing.T) {
+	tests := []struct {
+		name   string
+		commit bool
+		want   int
+	}{
+		{name: "committed", commit: true, want: 1},
+		{name: "rolled back", commit: false, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "a.log")
+			writeFile(t, file, "line 1\n")
+
+			db := openTestDB(t, "sqlite3")
+			if _, err := db.Exec("CREATE TABLE t(a TEXT)"); err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := LoadCheckpoints(db, "t")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tx, err := db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := tx.Exec("INSERT INTO t VALUES('line 1')"); err != nil {
+				t.Fatal(err)
+			}
+
+			c.Mark(openFileID(t, file), 7)
+
+			if err := c.Save(tx); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.commit {
+				err = tx.Commit()
+			} else {
+				err = tx.Rollback()
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var records, checkpoints int
+			if err := db.QueryRow("SELECT COUNT(*) FROM t").Scan(&records); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := db.QueryRow("SELECT COUNT(*) FROM logline_checkpoint").Scan(&checkpoints); err != nil {
+				t.Fatal(err)
+			}
+
+			// The checkpoint is committed or rolled back with the records.
+			if records != tt.want || checkpoints != tt.want {
+				t.Errorf("%d records and %d checkpoints, want %d", records, checkpoints, tt.want)
+			}
+		})
+	}
+}
+
+// writeFile writes the content to the file, truncated if exists.
+func writeFile(t *testing.T, file, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// openFileID returns the identity of the file.
+func openFileID(t *testing.T, file string) FileID {
+	t.Helper()
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	id, err := fileIdentity(f, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
@@ -4,7 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"log"
-	"strings"
+	"math/rand"
 	"sync/atomic"
 	"time"
 
@@ -22,6 +22,7 @@ type ConcurrentCmd struct {
 	writes   int
 	maxConns int
 	duration time.Duration
+	conflict ConflictOptions
 
 	w, r int64
 }
@@ -49,22 +50,34 @@ func (g *ConcurrentCmd) initFlags(f *pflag.FlagSet) {
 	f.Int64Var(&g.from, "from", 0, "ID from for writes")
 	f.IntVarP(&g.maxConns, "maxConns", "m", 1, "max of open connections to db.")
 	f.DurationVarP(&g.duration, "duration", "d", 60*time.Second, "duration to run")
+	g.conflict.initFlags(f)
 }
 
 func (g *ConcurrentCmd) run(cmd *cobra.Command, args []string) {
 	log.Printf("concurrent reads and writes verifying")
 
+	if err := g.conflict.validate(tables["bench"]); err != nil {
+		log.Fatal(err)
+	}
+
 	db := setupBench(g.clear, g.maxConns)
 	if g.close {
 		defer db.Close()
 	}
 
-	closeCh := make(chan bool)
-	quitCh := make(chan bool)
-
 	ctx, cancelFn := context.WithTimeout(cmd.Context(), g.duration)
 	defer cancelFn()
 
+	stop := g.start(ctx, db)
+	<-ctx.Done()
+	stop()
+}
+
+// start starts the reads and writes goroutines, and returns the function to stop and wait for them.
+func (g *ConcurrentCmd) start(ctx context.Context, db *sql.DB) (stop func()) {
+	closeCh := make(chan bool)
+	quitCh := make(chan bool)
+
 	for i := 0; i < g.reads; i++ {
 		go g.read(ctx, db, closeCh, quitCh)
 	}
@@ -75,16 +88,21 @@ func (g *ConcurrentCmd) run(cmd *cobra.Command, args []string) {
 		go g.write(ctx, db, closeCh, quitCh)
 	}
 
-	<-ctx.Done()
+	return func() {
+		log.Printf("notify all reads and writes goroutines to exit")
+		close(closeCh)
 
-	log.Printf("notify all reads and writes goroutines to exit")
-	close(closeCh)
+		for i := 0; i < g.reads+g.writes; i++ {
+			<-quitCh
+		}
 
-	for i := 0; i < g.reads+g.writes; i++ {
-		<-quitCh
+		log.Printf("all reads and writes goroutines exited")
 	}
+}
 
-	log.Printf("all reads and writes goroutines exited")
+// written returns the number of the rows written since started.
+func (g *ConcurrentCmd) written() int64 {
+	return atomic.LoadInt64(&g.w) - g.from
 }
 
 func (g *ConcurrentCmd) write(ctx context.Context, db *sql.DB, closeCh, quitCh chan bool) {
@@ -93,17 +111,22 @@ func (g *ConcurrentCmd) write(ctx context.Context, db *sql.DB, closeCh, quitCh c
 		quitCh <- true
 	}()
 
-	const query = "insert into bench(id, rand, hash) values(?, ?, ?)"
+	query := tables["bench"].CreateInsertSQL(DriverDialect(driverName), g.conflict.Mode, 1)
 	for goon(ctx, closeCh) {
 		s, sum := h.Gen()
 		wc := atomic.AddInt64(&g.w, 1)
+		id := wc
+		// With the overlap ratio, reuse a random ID already written to conflict deliberately.
+		if wc > g.from+1 && g.conflict.Overlap > 0 && rand.Float64() < g.conflict.Overlap { // nolint:gosec
+			id = g.from + 1 + rand.Int63n(wc-g.from-1) // nolint:gosec
+		}
 		// log.Printing("insert ID:%d, rand:%s, hash:%s", id, s, sum)
-		if _, err := db.ExecContext(ctx, query, wc, s, sum); err != nil {
+		if _, err := db.ExecContext(ctx, query, id, s, sum); err != nil {
 			if ctx.Err() != nil {
 				return
 			}
 
-			if errs := err.Error(); strings.Contains(errs, "UNIQUE constraint failed:") {
+			if IsUniqueViolation(err) {
 				log.Printf("Inserting values into database failed: %s", err)
 			} else {
 				log.Fatalf("Inserting values into database failed: %s", err)
@@ -0,0 +1,165 @@
+package sqlite3perf
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// Conflict modes of inserting records whose keys already exist.
+const (
+	// ConflictPlain is the plain INSERT, fails on conflicts.
+	ConflictPlain = "plain"
+	// ConflictIgnore skips the conflicting records.
+	ConflictIgnore = "ignore"
+	// ConflictReplace deletes the existing record before inserting the new one.
+	ConflictReplace = "replace"
+	// ConflictUpsert updates the existing record by the new values.
+	ConflictUpsert = "upsert"
+)
+
+// ConflictOptions defines how to insert records with conflicting keys.
+type ConflictOptions struct {
+	Mode string
+	// Overlap is the ratio of generated records which deliberately reuse existing keys.
+	Overlap float64
+}
+
+func (c *ConflictOptions) initFlags(f *pflag.FlagSet) {
+	f.StringVar(&c.Mode, "conflict", ConflictPlain, "insert conflict mode(plain/ignore/replace/upsert)")
+	f.Float64Var(&c.Overlap, "overlap", 0, "ratio(0-1) of records generated with conflicting keys")
+}
+
+func (c ConflictOptions) validate(t Table) error {
+	switch c.Mode {
+	case ConflictPlain, ConflictIgnore, ConflictReplace, ConflictUpsert:
+	default:
+		return fmt.Errorf("unknown conflict mode %s", c.Mode)
+	}
+
+	if c.Overlap < 0 || c.Overlap > 1 {
+		return fmt.Errorf("overlap %v should be between 0 and 1", c.Overlap)
+	}
+
+	if c.Overlap > 0 && c.Mode == ConflictPlain {
+		return fmt.Errorf("overlap %v with conflict mode %s fails on the first conflicting key, "+
+			"pick --conflict %s, %s or %s", c.Overlap, c.Mode, ConflictIgnore, ConflictReplace, ConflictUpsert)
+	}
+
+	if key, ok := t.KeyColumn(); c.Overlap > 0 && (!ok || key.AutoIncrement) {
+		return fmt.Errorf("table %s has no client generated key to overlap", t.Name)
+	}
+
+	return nil
+}
+
+// InsertSQL creates the multi-rows INSERT statement of the conflict mode in the dialect.
+func (d Dialect) InsertSQL(conflict, table string, columns, keys []string, batchSize int) string {
+	values := "(" + strings.Repeat(",?", len(columns))[1:] + ")"
+	into := table + "(" + strings.Join(columns, ", ") + ") VALUES" + strings.Repeat(","+values, batchSize)[1:]
+
+	var updates []string
+	for _, c := range columns {
+		if !contains(keys, c) {
+			updates = append(updates, c)
+		}
+	}
+
+	var s string
+
+	switch d {
+	case MySQL:
+		switch conflict {
+		case ConflictIgnore:
+			s = "INSERT IGNORE INTO " + into
+		case ConflictReplace:
+			s = "REPLACE INTO " + into
+		case ConflictUpsert:
+			s = "INSERT INTO " + into + " ON DUPLICATE KEY UPDATE " + assignments(updates, "%s=VALUES(%s)")
+		default:
+			s = "INSERT INTO " + into
+		}
+	case Postgres:
+		switch conflict {
+		case ConflictIgnore:
+			s = "INSERT INTO " + into + " ON CONFLICT DO NOTHING"
+		case ConflictReplace, ConflictUpsert:
+			// PostgreSQL has no REPLACE, overwriting all the columns is the closest.
+			s = "INSERT INTO " + into + " ON CONFLICT (" + strings.Join(keys, ", ") + ") DO UPDATE SET " +
+				assignments(updates, "%s=EXCLUDED.%s")
+		default:
+			s = "INSERT INTO " + into
+		}
+	default:
+		switch conflict {
+		case ConflictIgnore:
+			s = "INSERT OR IGNORE INTO " + into
+		case ConflictReplace:
+			s = "INSERT OR REPLACE INTO " + into
+		case ConflictUpsert:
+			// UPSERT requires SQLite 3.24.0+.
+			s = "INSERT INTO " + into + " ON CONFLICT(" + strings.Join(keys, ", ") + ") DO UPDATE SET " +
+				assignments(updates, "%s=excluded.%s")
+		default:
+			s = "INSERT INTO " + into
+		}
+	}
+
+	return d.Rebind(s)
+}
+
+func assignments(columns []string, format string) string {
+	s := make([]string, len(columns))
+	for i, c := range columns {
+		s[i] = fmt.Sprintf(format, c, c)
+	}
+
+	return strings.Join(s, ", ")
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// overlapKeys picks the keys of the generated records, a share of which reuses the keys
+// of the previous batch to conflict with the existing records deliberately.
+// By reusing the key at the same position of the previous batch, keys in a single batch are always distinct,
+// which is required by PostgreSQL's ON CONFLICT DO UPDATE.
+type overlapKeys struct {
+	ratio     float64
+	batchSize int
+	prev, cur []int
+	conflicts int
+}
+
+func newOverlapKeys(ratio float64, batchSize int) *overlapKeys {
+	return &overlapKeys{
+		ratio:     ratio,
+		batchSize: batchSize,
+		prev:      make([]int, 0, batchSize),
+		cur:       make([]int, 0, batchSize),
+	}
+}
+
+// Next returns the key of the i-th record.
+func (o *overlapKeys) Next(i int) int {
+	key := i
+	if j := len(o.cur); j < len(o.prev) && o.ratio > 0 && rand.Float64() < o.ratio { // nolint:gosec
+		key = o.prev[j]
+		o.conflicts++
+	}
+
+	if o.cur = append(o.cur, key); len(o.cur) == o.batchSize {
+		o.prev, o.cur = o.cur, o.prev[:0]
+	}
+
+	return key
+}
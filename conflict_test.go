@@ -0,0 +1,146 @@
+package sqlite3perf
+
+import "testing"
+
+func TestInsertSQL(t *testing.T) {
+	columns, keys := []string{"id", "a", "b"}, []string{"id"}
+
+	tests := []struct {
+		d        Dialect
+		conflict string
+		want     string
+	}{
+		{SQLite, ConflictPlain, "INSERT INTO t(id, a, b) VALUES(?,?,?),(?,?,?)"},
+		{SQLite, ConflictIgnore, "INSERT OR IGNORE INTO t(id, a, b) VALUES(?,?,?),(?,?,?)"},
+		{SQLite, ConflictReplace, "INSERT OR REPLACE INTO t(id, a, b) VALUES(?,?,?),(?,?,?)"},
+		{SQLite, ConflictUpsert, "INSERT INTO t(id, a, b) VALUES(?,?,?),(?,?,?) " +
+			"ON CONFLICT(id) DO UPDATE SET a=excluded.a, b=excluded.b"},
+		{MySQL, ConflictPlain, "INSERT INTO t(id, a, b) VALUES(?,?,?),(?,?,?)"},
+		{MySQL, ConflictIgnore, "INSERT IGNORE INTO t(id, a, b) VALUES(?,?,?),(?,?,?)"},
+		{MySQL, ConflictReplace, "REPLACE INTO t(id, a, b) VALUES(?,?,?),(?,?,?)"},
+		{MySQL, ConflictUpsert, "INSERT INTO t(id, a, b) VALUES(?,?,?),(?,?,?) " +
+			"ON DUPLICATE KEY UPDATE a=VALUES(a), b=VALUES(b)"},
+		{Postgres, ConflictPlain, "INSERT INTO t(id, a, b) VALUES($1,$2,$3),($4,$5,$6)"},
+		{Postgres, ConflictIgnore, "INSERT INTO t(id, a, b) VALUES($1,$2,$3),($4,$5,$6) ON CONFLICT DO NOTHING"},
+		{Postgres, ConflictReplace, "INSERT INTO t(id, a, b) VALUES($1,$2,$3),($4,$5,$6) " +
+			"ON CONFLICT (id) DO UPDATE SET a=EXCLUDED.a, b=EXCLUDED.b"},
+		{Postgres, ConflictUpsert, "INSERT INTO t(id, a, b) VALUES($1,$2,$3),($4,$5,$6) " +
+			"ON CONFLICT (id) DO UPDATE SET a=EXCLUDED.a, b=EXCLUDED.b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.d)+" "+tt.conflict, func(t *testing.T) {
+			if got := tt.d.InsertSQL(tt.conflict, "t", columns, keys, 2); got != tt.want {
+				t.Errorf("InsertSQL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInsertSQLSQLite(t *testing.T) {
+	tests := []struct {
+		conflict string
+		want     string
+		wantErr  bool
+	}{
+		{conflict: ConflictPlain, wantErr: true},
+		{conflict: ConflictIgnore, want: "1:x:x,2:y:y"},
+		{conflict: ConflictReplace, want: "1:z:,2:y:y"},
+		{conflict: ConflictUpsert, want: "1:z:,2:y:y"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.conflict, func(t *testing.T) {
+			db := openTestDB(t, "sqlite3")
+			if _, err := db.Exec("CREATE TABLE t(id INTEGER PRIMARY KEY, a TEXT, b TEXT)"); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := db.Exec("INSERT INTO t VALUES(1, 'x', 'x'), (2, 'y', 'y')"); err != nil {
+				t.Fatal(err)
+			}
+
+			// Both replace and upsert overwrite all the columns of the existing record, b by null.
+			query := SQLite.InsertSQL(tt.conflict, "t", []string{"id", "a", "b"}, []string{"id"}, 1)
+			if _, err := db.Exec(query, 1, "z", nil); (err != nil) != tt.wantErr {
+				t.Fatalf("Exec(%s) error = %v, wantErr %v", query, err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			var got string
+			if err := db.QueryRow("SELECT GROUP_CONCAT(id || ':' || a || ':' || IFNULL(b, ''), ',') " +
+				"FROM (SELECT * FROM t ORDER BY id)").Scan(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("records = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConflictOptionsValidate(t *testing.T) {
+	keyed := Table{Name: "t", Columns: []Column{{Name: "id", Type: TypeInt, PrimaryKey: true}}}
+	autoIncrement := Table{Name: "t", Columns: []Column{{Name: "id", Type: TypeInt, PrimaryKey: true,
+		AutoIncrement: true}}}
+
+	tests := []struct {
+		name    string
+		c       ConflictOptions
+		t       Table
+		wantErr bool
+	}{
+		{name: "plain", c: ConflictOptions{Mode: ConflictPlain}, t: keyed},
+		{name: "upsert overlapped", c: ConflictOptions{Mode: ConflictUpsert, Overlap: 0.5}, t: keyed},
+		{name: "all overlapped", c: ConflictOptions{Mode: ConflictIgnore, Overlap: 1}, t: keyed},
+		{name: "unknown mode", c: ConflictOptions{Mode: "merge"}, t: keyed, wantErr: true},
+		{name: "negative overlap", c: ConflictOptions{Mode: ConflictReplace, Overlap: -0.1}, t: keyed, wantErr: true},
+		{name: "overlap greater than 1", c: ConflictOptions{Mode: ConflictReplace, Overlap: 1.1}, t: keyed,
+			wantErr: true},
+		{name: "plain overlapped", c: ConflictOptions{Mode: ConflictPlain, Overlap: 0.5}, t: keyed, wantErr: true},
+		{name: "overlapped without key", c: ConflictOptions{Mode: ConflictReplace, Overlap: 0.5}, t: Table{Name: "t"},
+			wantErr: true},
+		{name: "overlapped auto increment key", c: ConflictOptions{Mode: ConflictReplace, Overlap: 0.5},
+			t: autoIncrement, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.c.validate(tt.t); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOverlapKeys(t *testing.T) {
+	tests := []struct {
+		name          string
+		ratio         float64
+		want          []int
+		wantConflicts int
+	}{
+		{name: "no overlap", ratio: 0, want: []int{0, 1, 2, 3, 4, 5, 6}},
+		// The keys at the same positions of the previous batch, distinct in a batch.
+		{name: "all overlapped", ratio: 1, want: []int{0, 1, 2, 0, 1, 2, 0}, wantConflicts: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOverlapKeys(tt.ratio, 3)
+			for i, want := range tt.want {
+				if got := o.Next(i); got != want {
+					t.Errorf("Next(%d) = %d, want %d", i, got, want)
+				}
+			}
+
+			if o.conflicts != tt.wantConflicts {
+				t.Errorf("conflicts = %d, want %d", o.conflicts, tt.wantConflicts)
+			}
+		})
+	}
+}
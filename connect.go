@@ -0,0 +1,139 @@
+package sqlite3perf
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// nolint:gochecknoglobals
+var initStatements []string
+
+// openWithInit opens the database of dsn by the driver, with the statements run on every new connection
+// of the pool, by the ConnectHook of mattn/go-sqlite3, or by a wrapping connector for the other drivers.
+func openWithInit(driverName, dsn string, statements []string) (*sql.DB, error) {
+	if len(statements) == 0 {
+		return sql.Open(driverName, dsn)
+	}
+
+	if driverName == "sqlite3" {
+		d, err := sqlite3InitDriver(statements)
+		if err != nil {
+			return nil, err
+		}
+
+		return sql.OpenDB(&dsnConnector{dsn: dsn, driver: d}), nil
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	d := db.Driver()
+	_ = db.Close()
+
+	var connector driver.Connector = &dsnConnector{dsn: dsn, driver: d}
+	if dc, ok := d.(driver.DriverContext); ok {
+		if connector, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+
+	return sql.OpenDB(&initConnector{Connector: connector, statements: statements}), nil
+}
+
+// dsnConnector is the driver.Connector of the drivers without driver.DriverContext.
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c *dsnConnector) Connect(context.Context) (driver.Conn, error) { return c.driver.Open(c.dsn) }
+func (c *dsnConnector) Driver() driver.Driver                        { return c.driver }
+
+// initConnector runs the statements on every new connection of the wrapped connector.
+type initConnector struct {
+	driver.Connector
+	statements []string
+}
+
+func (c *initConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runInitStatements(conn, c.statements); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func runInitStatements(conn driver.Conn, statements []string) error {
+	for _, s := range statements {
+		if err := execConn(conn, s); err != nil {
+			return fmt.Errorf("init statement %s: %w", s, err)
+		}
+	}
+
+	return nil
+}
+
+// execConn executes the statement on the driver connection.
+func execConn(conn driver.Conn, query string) error {
+	if e, ok := conn.(driver.ExecerContext); ok {
+		_, err := e.ExecContext(context.Background(), query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+
+	if e, ok := conn.(driver.Execer); ok { // nolint:staticcheck
+		_, err := e.Exec(query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(nil) // nolint:staticcheck
+
+	return err
+}
+
+// connInitStatements returns the statements run on every new connection, the PRAGMAs not supported
+// by the DSN followed by the --init ones, of which PRAGMAs are validated against the catalog.
+func connInitStatements(afterOpen []string) []string {
+	statements := make([]string, 0, len(afterOpen)+len(initStatements))
+	for _, p := range afterOpen {
+		statements = append(statements, "PRAGMA "+p)
+	}
+
+	for _, s := range initStatements {
+		if s = strings.TrimRight(strings.TrimSpace(s), "; \t\r\n"); s == "" {
+			continue
+		}
+
+		if fields := strings.Fields(s); strings.EqualFold(fields[0], "PRAGMA") {
+			p := strings.TrimSpace(s[len(fields[0]):])
+			if _, err := ParsePragma(p, false); err != nil {
+				log.Fatalf("--init %s: %v", s, err)
+			}
+		}
+
+		statements = append(statements, s)
+	}
+
+	return statements
+}
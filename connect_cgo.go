@@ -0,0 +1,17 @@
+//go:build cgo
+
+package sqlite3perf
+
+import (
+	"database/sql/driver"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// sqlite3InitDriver returns the mattn/go-sqlite3 driver running the statements on every new connection
+// by its ConnectHook.
+func sqlite3InitDriver(statements []string) (driver.Driver, error) {
+	return &sqlite3.SQLiteDriver{ConnectHook: func(c *sqlite3.SQLiteConn) error {
+		return runInitStatements(c, statements)
+	}}, nil
+}
@@ -0,0 +1,13 @@
+//go:build !cgo
+
+package sqlite3perf
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// sqlite3InitDriver fails, mattn/go-sqlite3 is only a stub without cgo.
+func sqlite3InitDriver([]string) (driver.Driver, error) {
+	return nil, fmt.Errorf("--init with driver sqlite3 requires cgo, use --driver sqlite instead")
+}
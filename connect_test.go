@@ -0,0 +1,36 @@
+package sqlite3perf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConnInitStatements(t *testing.T) {
+	tests := []struct {
+		name      string
+		afterOpen []string
+		init      []string
+		want      []string
+	}{
+		{name: "none", want: []string{}},
+		{name: "after open first", afterOpen: []string{"mmap_size=0"}, init: []string{"PRAGMA cache_size=-2000"},
+			want: []string{"PRAGMA mmap_size=0", "PRAGMA cache_size=-2000"}},
+		{name: "trailing semicolon", init: []string{"PRAGMA journal_mode=WAL;"},
+			want: []string{"PRAGMA journal_mode=WAL"}},
+		{name: "blank and semicolons only skipped", init: []string{" ", ";", "pragma foreign_keys=on ; "},
+			want: []string{"pragma foreign_keys=on"}},
+		{name: "not a PRAGMA kept", init: []string{"SELECT 1;"}, want: []string{"SELECT 1"}},
+	}
+
+	saved := initStatements
+	defer func() { initStatements = saved }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			initStatements = tt.init
+			if got := connInitStatements(tt.afterOpen); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("connInitStatements() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package sqlite3perf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// convertDirective is the prefix of the directive lines in the pattern file,
+// like -- @convert cost=duration ts=timestamp:unix, which are comments to the patterns.
+const convertDirective = "-- @convert"
+
+// Converter converts the value of a dot of the patterns into the values of its columns.
+type Converter struct {
+	// Dot is the name of the dot converted.
+	Dot string
+	// Kind is the kind of the conversion, duration, timestamp, ip or url.
+	Kind string
+	// Arg is the argument of the kind, like unix of timestamp:unix.
+	Arg string
+
+	// failed is the number of the values failed to convert, which are stored as NULL.
+	failed int64
+}
+
+// Converters are the converters by the dot names.
+type Converters map[string]*Converter
+
+// timestampLayouts are the layouts tried to parse the timestamps, without zones in the local time zone.
+// nolint:gochecknoglobals
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006/01/02 15:04:05.999999999",
+	"02/Jan/2006:15:04:05 -0700",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// ParseConverters parses the convert directives of the pattern file.
+func ParseConverters(patternFile string) (Converters, error) {
+	f, err := os.Open(patternFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	convs := make(Converters)
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, convertDirective) {
+			continue
+		}
+
+		for _, field := range strings.Fields(line[len(convertDirective):]) {
+			c, err := parseConverter(field)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", line, err)
+			}
+
+			convs[c.Dot] = c
+		}
+	}
+
+	return convs, scanner.Err()
+}
+
+// parseConverter parses the converter like cost=duration or ts=timestamp:unix.
+func parseConverter(s string) (*Converter, error) {
+	p := strings.IndexByte(s, '=')
+	if p <= 0 {
+		return nil, fmt.Errorf("bad converter %s, should be like name=kind[:arg]", s)
+	}
+
+	c := &Converter{Dot: s[:p], Kind: s[p+1:]}
+	if q := strings.IndexByte(c.Kind, ':'); q >= 0 {
+		c.Kind, c.Arg = c.Kind[:q], c.Kind[q+1:]
+	}
+
+	switch c.Kind {
+	case "duration", "ip", "url":
+		if c.Arg != "" {
+			return nil, fmt.Errorf("converter %s has no argument", c.Kind)
+		}
+	case "timestamp":
+		switch c.Arg {
+		case "":
+			c.Arg = "iso"
+		case "iso", "unix", "unixms":
+		default:
+			return nil, fmt.Errorf("unknown timestamp format %s, should be iso, unix or unixms", c.Arg)
+		}
+	default:
+		return nil, fmt.Errorf("unknown converter %s, should be duration, timestamp, ip or url", c.Kind)
+	}
+
+	return c, nil
+}
+
+// Columns returns the columns of the converted values.
+func (c *Converter) Columns() []Column {
+	switch c.Kind {
+	case "duration":
+		return []Column{{Name: c.Dot, Type: TypeBigInt, Comment: "nanoseconds"}}
+	case "timestamp":
+		if c.Arg == "iso" {
+			return []Column{{Name: c.Dot, Type: TypeVarchar, Size: 35, Comment: "RFC3339 in UTC"}}
+		}
+
+		return []Column{{Name: c.Dot, Type: TypeBigInt, Comment: "unix epoch in " + c.Arg}}
+	case "ip":
+		return []Column{{Name: c.Dot, Type: TypeBigInt, Comment: "IPv4 as an integer"}}
+	default: // url
+		return []Column{
+			{Name: c.Dot + "_host", Type: TypeText},
+			{Name: c.Dot + "_path", Type: TypeText},
+			{Name: c.Dot + "_query", Type: TypeText},
+		}
+	}
+}
+
+// Convert converts the value into the values of the columns, NULLs if failed.
+func (c *Converter) Convert(v interface{}) []interface{} {
+	values, err := c.convert(strings.TrimSpace(fmt.Sprint(v)))
+	if err != nil {
+		c.failed++
+		return make([]interface{}, len(c.Columns()))
+	}
+
+	return values
+}
+
+func (c *Converter) convert(s string) ([]interface{}, error) {
+	switch c.Kind {
+	case "duration":
+		d, err := time.ParseDuration(s)
+		return []interface{}{int64(d)}, err
+	case "timestamp":
+		t, err := parseTimestamp(s)
+		if err != nil {
+			return nil, err
+		}
+
+		switch c.Arg {
+		case "unix":
+			return []interface{}{t.Unix()}, nil
+		case "unixms":
+			return []interface{}{t.UnixMilli()}, nil
+		default:
+			return []interface{}{t.UTC().Format(time.RFC3339Nano)}, nil
+		}
+	case "ip":
+		n, err := ipv4Int(s)
+		return []interface{}{n}, err
+	default: // url
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+
+		return []interface{}{u.Host, u.Path, u.RawQuery}, nil
+	}
+}
+
+func parseTimestamp(s string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unknown timestamp %s", s)
+}
+
+// ipv4Int converts the IPv4 address, optionally with the port, into an integer.
+func ipv4Int(s string) (int64, error) {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		return 0, fmt.Errorf("not an IPv4 address %s", s)
+	}
+
+	return int64(binary.BigEndian.Uint32(ip)), nil
+}
+
+// Apply converts the values of the dots parsed of a line in place into the values by the column names,
+// by the writer of the pipeline only.
+func (cs Converters) Apply(values map[string]interface{}) {
+	for name, c := range cs {
+		v, ok := values[name]
+		if !ok {
+			continue
+		}
+
+		delete(values, name)
+
+		converted := c.Convert(v)
+		for i, col := range c.Columns() {
+			values[col.Name] = converted[i]
+		}
+	}
+}
+
+// LogFailures logs the numbers of the values failed to convert.
+func (cs Converters) LogFailures() {
+	for _, c := range cs {
+		if n := c.failed; n > 0 {
+			log.Printf("%d values of %s failed to convert by %s, stored as NULL", n, c.Dot, c)
+		}
+	}
+}
+
+func (c *Converter) String() string {
+	if c.Arg == "" {
+		return c.Kind
+	}
+
+	return c.Kind + ":" + c.Arg
+}
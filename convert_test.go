@@ -0,0 +1,115 @@
+package sqlite3perf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseConverter(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Converter
+		wantErr bool
+	}{
+		{s: "cost=duration", want: Converter{Dot: "cost", Kind: "duration"}},
+		{s: "ts=timestamp", want: Converter{Dot: "ts", Kind: "timestamp", Arg: "iso"}},
+		{s: "ts=timestamp:unixms", want: Converter{Dot: "ts", Kind: "timestamp", Arg: "unixms"}},
+		{s: "src=ip", want: Converter{Dot: "src", Kind: "ip"}},
+		{s: "path=url", want: Converter{Dot: "path", Kind: "url"}},
+		{s: "ts=timestamp:rfc822", wantErr: true},
+		{s: "src=ip:v4", wantErr: true},
+		{s: "cost=size", wantErr: true},
+		{s: "=duration", wantErr: true},
+		{s: "cost", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseConverter(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseConverter(%s) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+
+			if !tt.wantErr && *got != tt.want {
+				t.Errorf("parseConverter(%s) = %+v, want %+v", tt.s, *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConverterConvert(t *testing.T) {
+	ts := time.Date(2021, 5, 29, 13, 9, 46, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		c    Converter
+		v    interface{}
+		want []interface{}
+	}{
+		{name: "duration", c: Converter{Kind: "duration"}, v: "2.869717ms", want: []interface{}{int64(2869717)}},
+		{name: "bad duration", c: Converter{Kind: "duration"}, v: "fast", want: []interface{}{nil}},
+		{name: "iso", c: Converter{Kind: "timestamp", Arg: "iso"}, v: "2021-05-29T13:09:46Z",
+			want: []interface{}{"2021-05-29T13:09:46Z"}},
+		{name: "access log time", c: Converter{Kind: "timestamp", Arg: "unix"}, v: "29/May/2021:13:09:46 +0000",
+			want: []interface{}{ts.Unix()}},
+		{name: "unixms", c: Converter{Kind: "timestamp", Arg: "unixms"}, v: "2021-05-29 13:09:46.5Z",
+			want: []interface{}{ts.UnixMilli() + 500}},
+		{name: "bad timestamp", c: Converter{Kind: "timestamp", Arg: "unix"}, v: "yesterday", want: []interface{}{nil}},
+		{name: "ip", c: Converter{Kind: "ip"}, v: "192.168.2.2", want: []interface{}{int64(0xC0A80202)}},
+		{name: "ip with port", c: Converter{Kind: "ip"}, v: "10.0.0.1:8080", want: []interface{}{int64(0x0A000001)}},
+		{name: "ipv6", c: Converter{Kind: "ip"}, v: "::1", want: []interface{}{nil}},
+		{name: "url", c: Converter{Kind: "url"}, v: "http://a.b:8983/solr/update?wt=javabin",
+			want: []interface{}{"a.b:8983", "/solr/update", "wt=javabin"}},
+		{name: "bad url", c: Converter{Kind: "url"}, v: "http://a b/%zz", want: []interface{}{nil, nil, nil}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.c
+			got := c.Convert(tt.v)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Convert(%v) = %v, want %v", tt.v, got, tt.want)
+			}
+
+			if failed := tt.want[0] == nil; failed != (c.failed == 1) {
+				t.Errorf("Convert(%v) failed = %d", tt.v, c.failed)
+			}
+		})
+	}
+}
+
+func TestParseConvertersApply(t *testing.T) {
+	patternFile := filepath.Join(t.TempDir(), "pattern.txt")
+	patterns := "-- @convert cost=duration src=ip\n" +
+		"Pattern#1 #2 ##3 ###4 cost #5 src\n" +
+		"-- @convert path=url\n"
+
+	if err := os.WriteFile(patternFile, []byte(patterns), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	convs, err := ParseConverters(patternFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(convs) != 3 {
+		t.Fatalf("ParseConverters() = %v, want cost, src and path", convs)
+	}
+
+	values := map[string]interface{}{"cost": "1.5s", "src": "127.0.0.1", "path": "/a?b=1", "id": "x"}
+	convs.Apply(values)
+
+	want := map[string]interface{}{
+		"cost": int64(1500 * time.Millisecond), "src": int64(0x7F000001),
+		"path_host": "", "path_path": "/a", "path_query": "b=1", "id": "x",
+	}
+
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("Apply() = %v, want %v", values, want)
+	}
+}
@@ -0,0 +1,188 @@
+package sqlite3perf
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Dialect is the SQL flavor spoken by a database driver.
+type Dialect string
+
+const (
+	// SQLite is the dialect of both the sqlite3 (mattn) and sqlite (modernc) drivers.
+	SQLite Dialect = "sqlite"
+	// MySQL is the dialect of the mysql driver.
+	MySQL Dialect = "mysql"
+	// Postgres is the dialect of PostgreSQL.
+	Postgres Dialect = "postgres"
+)
+
+// DriverDialect returns the dialect spoken by the named database/sql driver.
+func DriverDialect(driver string) Dialect {
+	switch driver {
+	case "mysql":
+		return MySQL
+	case "pgx", "postgres":
+		return Postgres
+	default:
+		return SQLite
+	}
+}
+
+// Rebind converts the ? placeholders of the query to the form of the dialect, e.g. $1, $2 for Postgres.
+func (d Dialect) Rebind(query string) string {
+	if d != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + len(query)/4)
+
+	n := 0
+	for i := 0; i < len(query); i++ {
+		if query[i] != '?' {
+			b.WriteByte(query[i])
+			continue
+		}
+
+		n++
+		b.WriteByte('$')
+		b.WriteString(strconv.Itoa(n))
+	}
+
+	return b.String()
+}
+
+// SQLITE_MAX_VARIABLE_NUMBER defaults to 999 for SQLite versions prior to 3.32.0 (2020-05-22) and 32766 after.
+const (
+	sqliteLegacyMaxVariables = 999
+	sqliteMaxVariables       = 32766
+)
+
+// DetectMaxPlaceholders detects the max number of placeholders in a single statement of the db,
+// and tells where the number comes from.
+func (d Dialect) DetectMaxPlaceholders(db *sql.DB) (max int, from string) {
+	if d != SQLite {
+		return d.MaxPlaceholders(), "protocol limit of " + string(d)
+	}
+
+	if options, err := CompileOptions(db); err == nil {
+		for _, o := range options {
+			if v := strings.TrimPrefix(o, "MAX_VARIABLE_NUMBER="); v != o {
+				if n, err := strconv.Atoi(v); err == nil {
+					return n, "compile option " + o
+				}
+			}
+		}
+	}
+
+	// Numbered parameters larger than SQLITE_MAX_VARIABLE_NUMBER fail to prepare.
+	probe := "SELECT ?" + strconv.Itoa(sqliteMaxVariables)
+	if ps, err := db.Prepare(probe); err == nil {
+		_ = ps.Close()
+		return sqliteMaxVariables, "probing " + probe
+	}
+
+	return sqliteLegacyMaxVariables, "probing " + probe + " failed, legacy default"
+}
+
+// CompileOptions returns the result of PRAGMA compile_options of SQLite.
+func CompileOptions(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("PRAGMA compile_options")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var options []string
+	for rows.Next() {
+		var o string
+		if err := rows.Scan(&o); err != nil {
+			return nil, err
+		}
+		options = append(options, o)
+	}
+
+	return options, rows.Err()
+}
+
+// strictMinVersion is the first SQLite version supporting the STRICT tables.
+const strictMinVersion = "3.37.0"
+
+// CheckSchema checks the schema variant is supported by the SQLite of db, e.g. the STRICT tables require
+// SQLite 3.37.0+, while github.com/mattn/go-sqlite3 v2.0.3 bundles 3.31.1.
+// The other dialects are left to Table.CreateSQL, which refuses the SQLite variants.
+func CheckSchema(db *sql.DB, d Dialect, schema string) error {
+	if d != SQLite || schema != SchemaStrict {
+		return nil
+	}
+
+	var version string
+	if err := db.QueryRow("SELECT sqlite_version()").Scan(&version); err != nil {
+		return err
+	}
+
+	if compareVersions(version, strictMinVersion) < 0 {
+		return fmt.Errorf("schema %s requires SQLite %s+, but driver %s has SQLite %s, try --driver sqlite",
+			schema, strictMinVersion, driverName, version)
+	}
+
+	return nil
+}
+
+// compareVersions compares the dotted versions like 3.31.1 by their numbers.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+
+		if x != y {
+			if x < y {
+				return -1
+			}
+
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// MaxPlaceholders returns the protocol limit of placeholders in a single statement, 0 for unknown.
+func (d Dialect) MaxPlaceholders() int {
+	switch d {
+	case MySQL, Postgres:
+		// MySQL 协议定义两个字节表示传输参数个数，因此最大值是2^16-1=65535
+		// 防止出现错误：failed Error 1390: Prepared statement contains too many placeholders
+		// The prepared statement protocol defines a signed `2 bytes` short to describe the number of parameters
+		// that will be retrieved from the server. The client firstly calls COM_STMT_PREPARE,
+		// for which it receives a COM_STMT_PREPARE response if successful.
+		// PostgreSQL's Bind message also uses an Int16 for the number of parameter values.
+		return 65535
+	default:
+		return 0
+	}
+}
+
+// IsUniqueViolation tells whether the err is caused by a violation of the primary key or a unique index.
+func IsUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	s := err.Error()
+
+	return strings.Contains(s, "UNIQUE constraint failed") || // sqlite
+		strings.Contains(s, "Duplicate entry") || // mysql
+		strings.Contains(s, "duplicate key value violates unique constraint") // postgres
+}
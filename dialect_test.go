@@ -0,0 +1,114 @@
+package sqlite3perf
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+// openTestDB opens a new SQLite database in the temp dir of the test by the driver.
+func openTestDB(t *testing.T, driver string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open(driver, filepath.Join(t.TempDir(), "a.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	return db
+}
+
+func TestCheckSchema(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  string
+		d       Dialect
+		schema  string
+		wantErr bool
+	}{
+		{name: "strict by the old SQLite of mattn", driver: "sqlite3", d: SQLite, schema: SchemaStrict, wantErr: true},
+		{name: "strict by modernc", driver: "sqlite", d: SQLite, schema: SchemaStrict},
+		{name: "rowid by the old SQLite of mattn", driver: "sqlite3", d: SQLite, schema: SchemaRowid},
+		// Not querying sqlite_version() of the other dialects, whose schema is checked by Table.CreateSQL.
+		{name: "strict of mysql", driver: "sqlite3", d: MySQL, schema: SchemaStrict},
+		{name: "strict of postgres", driver: "sqlite3", d: Postgres, schema: SchemaStrict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, tt.driver)
+			if err := CheckSchema(db, tt.d, tt.schema); (err != nil) != tt.wantErr {
+				t.Errorf("CheckSchema() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "3.31.1", b: "3.37.0", want: -1},
+		{a: "3.37.0", b: "3.37.0", want: 0},
+		{a: "3.38.5", b: "3.37.0", want: 1},
+		{a: "3.37", b: "3.37.0", want: 0},
+		{a: "3.100.0", b: "3.37.0", want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		d     Dialect
+		query string
+		want  string
+	}{
+		{d: Postgres, query: "INSERT INTO t(a, b) VALUES(?,?),(?,?)", want: "INSERT INTO t(a, b) VALUES($1,$2),($3,$4)"},
+		{d: Postgres, query: "SELECT a FROM t WHERE a > ? AND b = ?", want: "SELECT a FROM t WHERE a > $1 AND b = $2"},
+		{d: Postgres, query: "SELECT 1", want: "SELECT 1"},
+		{d: SQLite, query: "INSERT INTO t(a, b) VALUES(?,?)", want: "INSERT INTO t(a, b) VALUES(?,?)"},
+		{d: MySQL, query: "INSERT INTO t(a, b) VALUES(?,?)", want: "INSERT INTO t(a, b) VALUES(?,?)"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.d.Rebind(tt.query); got != tt.want {
+			t.Errorf("%s.Rebind(%s) = %s, want %s", tt.d, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestDetectMaxPlaceholders(t *testing.T) {
+	tests := []struct {
+		name     string
+		driver   string
+		d        Dialect
+		want     int
+		wantFrom string
+	}{
+		{name: "compile option of modernc", driver: "sqlite", d: SQLite, want: 32766,
+			wantFrom: "compile option MAX_VARIABLE_NUMBER=32766"},
+		// SQLite 3.31.1 of mattn has neither the compile option nor the limit 32766.
+		{name: "legacy default of mattn", driver: "sqlite3", d: SQLite, want: 999,
+			wantFrom: "probing SELECT ?32766 failed, legacy default"},
+		{name: "protocol limit of mysql", driver: "sqlite3", d: MySQL, want: 65535, wantFrom: "protocol limit of mysql"},
+		{name: "protocol limit of postgres", driver: "sqlite3", d: Postgres, want: 65535,
+			wantFrom: "protocol limit of postgres"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, from := tt.d.DetectMaxPlaceholders(openTestDB(t, tt.driver))
+			if got != tt.want || from != tt.wantFrom {
+				t.Errorf("DetectMaxPlaceholders() = %d, %s, want %d, %s", got, from, tt.want, tt.wantFrom)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package sqlite3perf
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Environment is the fingerprint of the environment where the results are measured,
+// so that results of different runs can be compared.
+type Environment struct {
+	Driver         string            `json:"driver"`
+	ServerVersion  string            `json:"serverVersion"`
+	CompileOptions []string          `json:"compileOptions,omitempty"`
+	Pragmas        map[string]string `json:"pragmas,omitempty"`
+	GoVersion      string            `json:"goVersion"`
+	Modules        map[string]string `json:"modules,omitempty"`
+	OS             string            `json:"os"`
+	Kernel         string            `json:"kernel,omitempty"`
+	CPUModel       string            `json:"cpuModel,omitempty"`
+	NumCPU         int               `json:"numCPU"`
+	GOMAXPROCS     int               `json:"gomaxprocs"`
+	FileSystem     string            `json:"fileSystem,omitempty"`
+}
+
+// envPragmas are the PRAGMAs affecting the performance, whose effective values are recorded.
+// nolint:gochecknoglobals
+var envPragmas = []string{
+	"journal_mode", "synchronous", "locking_mode", "busy_timeout", "foreign_keys",
+	"page_size", "cache_size", "mmap_size", "temp_store", "auto_vacuum",
+}
+
+// envModules are the modules of the database drivers whose versions are recorded.
+// nolint:gochecknoglobals
+var envModules = []string{
+	"github.com/mattn/go-sqlite3",
+	"modernc.org/sqlite",
+	"github.com/go-sql-driver/mysql",
+	"github.com/jackc/pgx/v4",
+}
+
+// nolint:gochecknoinits
+func init() {
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "print the environment fingerprint of the database in JSON",
+		Run: func(*cobra.Command, []string) {
+			db := setupBench(false, 1)
+			defer db.Close()
+
+			out, _ := json.MarshalIndent(CollectEnvironment(db), "", "  ")
+			fmt.Println(string(out))
+		},
+	}
+
+	rootCmd.AddCommand(cmd)
+}
+
+// CollectEnvironment collects the environment fingerprint of the database,
+// the parts that could not be collected are left empty.
+func CollectEnvironment(db *sql.DB) Environment {
+	e := Environment{
+		Driver:     driverName,
+		GoVersion:  runtime.Version(),
+		OS:         runtime.GOOS + "/" + runtime.GOARCH,
+		Kernel:     kernelVersion(),
+		CPUModel:   cpuModel(),
+		NumCPU:     runtime.NumCPU(),
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		Modules:    buildModules(),
+	}
+
+	d := DriverDialect(driverName)
+	versionSQL := map[Dialect]string{
+		SQLite:   "SELECT sqlite_version()",
+		MySQL:    "SELECT VERSION()",
+		Postgres: "SHOW server_version",
+	}[d]
+
+	if err := db.QueryRow(versionSQL).Scan(&e.ServerVersion); err != nil {
+		log.Printf("query version error: %v", err)
+	}
+
+	if d != SQLite {
+		return e
+	}
+
+	e.CompileOptions, _ = CompileOptions(db)
+	e.Pragmas = make(map[string]string, len(envPragmas))
+
+	for _, name := range envPragmas {
+		if v, err := QueryPragmaValue(db, name); err == nil {
+			e.Pragmas[name] = v
+		}
+	}
+
+	if f := dbFile(); f != "" {
+		if abs, err := filepath.Abs(f); err == nil {
+			e.FileSystem = fileSystemType(filepath.Dir(abs))
+		}
+	}
+
+	return e
+}
+
+// buildModules returns the versions of the driver modules from the build info.
+func buildModules() map[string]string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+
+	modules := make(map[string]string)
+
+	for _, m := range info.Deps {
+		for _, name := range envModules {
+			if m.Path == name {
+				if m.Replace != nil {
+					m = m.Replace
+				}
+				modules[name] = m.Version
+			}
+		}
+	}
+
+	return modules
+}
+
+func (e Environment) String() string {
+	parts := []string{e.Driver + " " + e.ServerVersion}
+
+	for _, name := range envModules {
+		if v, ok := e.Modules[name]; ok {
+			parts = append(parts, name+" "+v)
+		}
+	}
+
+	parts = append(parts, e.GoVersion, e.OS)
+	if e.Kernel != "" {
+		parts = append(parts, "kernel "+e.Kernel)
+	}
+
+	cpu := fmt.Sprintf("%d CPUs(GOMAXPROCS %d)", e.NumCPU, e.GOMAXPROCS)
+	if e.CPUModel != "" {
+		cpu += " " + e.CPUModel
+	}
+
+	parts = append(parts, cpu)
+	if e.FileSystem != "" {
+		parts = append(parts, "filesystem "+e.FileSystem)
+	}
+
+	if len(e.Pragmas) > 0 {
+		pragmas := make([]string, 0, len(e.Pragmas))
+		for k, v := range e.Pragmas {
+			pragmas = append(pragmas, k+"="+v)
+		}
+
+		sort.Strings(pragmas)
+		parts = append(parts, "PRAGMA "+strings.Join(pragmas, " "))
+	}
+
+	return strings.Join(parts, ", ")
+}
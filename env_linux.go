@@ -0,0 +1,81 @@
+//go:build linux
+
+package sqlite3perf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// fileSystemTypes maps the magic numbers of statfs to the names of the common filesystems.
+// nolint:gochecknoglobals,gomnd
+var fileSystemTypes = map[uint32]string{
+	0xEF53:     "ext4",
+	0x58465342: "xfs",
+	0x9123683E: "btrfs",
+	0x01021994: "tmpfs",
+	0x2FC12FC1: "zfs",
+	0x794C7630: "overlayfs",
+	0x6969:     "nfs",
+	0xFF534D42: "cifs",
+	0x65735546: "fuse",
+	0xF2F52010: "f2fs",
+	0x858458F6: "ramfs",
+	0x01161970: "gfs2",
+	0x5346544E: "ntfs",
+	0x4D44:     "vfat",
+	0x65735543: "fusectl",
+	0x73717368: "squashfs",
+	0x62656572: "sysfs",
+	0x9FA0:     "proc",
+}
+
+// fileSystemType returns the filesystem type of the path by statfs.
+func fileSystemType(path string) string {
+	var s syscall.Statfs_t
+	if err := syscall.Statfs(path, &s); err != nil {
+		return ""
+	}
+
+	// The magic is 32 bits, but Statfs_t.Type is int32 on the 32-bit platforms, negative for those like cifs.
+	magic := uint32(s.Type)
+	if name, ok := fileSystemTypes[magic]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("0x%X", magic)
+}
+
+func kernelVersion() string {
+	return readFileLine("/proc/sys/kernel/osrelease")
+}
+
+// cpuModel returns the model name of the first CPU in /proc/cpuinfo.
+func cpuModel() string {
+	f, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	for s := bufio.NewScanner(f); s.Scan(); {
+		if k, v, ok := strings.Cut(s.Text(), ":"); ok && strings.TrimSpace(k) == "model name" {
+			return strings.TrimSpace(v)
+		}
+	}
+
+	return ""
+}
+
+// readFileLine returns the trimmed content of the small file, empty on error.
+func readFileLine(name string) string {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(b))
+}
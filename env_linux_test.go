@@ -0,0 +1,27 @@
+//go:build linux
+
+package sqlite3perf
+
+import "testing"
+
+func TestFileSystemType(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/proc", want: "proc"},
+		{path: "/not/exist", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := fileSystemType(tt.path); got != tt.want {
+			t.Errorf("fileSystemType(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+
+	// The magic of cifs is negative as the int32 Statfs_t.Type of the 32-bit platforms.
+	var cifs int32 = -0xACB2BE
+	if got := fileSystemTypes[uint32(cifs)]; got != "cifs" {
+		t.Errorf("fileSystemTypes[0x%X] = %s, want cifs", uint32(cifs), got)
+	}
+}
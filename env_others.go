@@ -0,0 +1,23 @@
+//go:build !linux
+
+package sqlite3perf
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// fileSystemType is not supported on the platform.
+func fileSystemType(string) string { return "" }
+
+func kernelVersion() string {
+	out, err := exec.Command("uname", "-r").Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// cpuModel is not supported on the platform.
+func cpuModel() string { return "" }
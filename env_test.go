@@ -0,0 +1,50 @@
+package sqlite3perf
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCollectEnvironment(t *testing.T) {
+	savedPath := dbPath
+	t.Cleanup(func() { dbPath = savedPath })
+
+	tests := []struct {
+		name           string
+		path           string
+		wantFileSystem bool
+		// noPragma is the PRAGMA returning no value.
+		noPragma string
+	}{
+		{name: "file", path: filepath.Join(t.TempDir(), "a.db"), wantFileSystem: runtime.GOOS == "linux"},
+		{name: "in-memory", path: ":memory:", noPragma: "mmap_size"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbPath = tt.path
+			db := openFileStatsDB(t, "")
+
+			e := CollectEnvironment(db)
+			if e.Driver != driverName || e.ServerVersion == "" || e.GoVersion != runtime.Version() || e.NumCPU < 1 {
+				t.Errorf("CollectEnvironment() = %+v", e)
+			}
+
+			for _, name := range envPragmas {
+				if _, ok := e.Pragmas[name]; ok != (name != tt.noPragma) {
+					t.Errorf("CollectEnvironment() PRAGMA %s collected %v", name, ok)
+				}
+			}
+
+			if (e.FileSystem != "") != tt.wantFileSystem {
+				t.Errorf("CollectEnvironment() file system %q, want %v", e.FileSystem, tt.wantFileSystem)
+			}
+
+			if s := e.String(); !strings.Contains(s, "PRAGMA auto_vacuum=") || !strings.Contains(s, e.ServerVersion) {
+				t.Errorf("String() = %s", s)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package sqlite3perf
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Type classes of the declared column types, by the rules of the SQLite type affinity,
+// https://www.sqlite.org/datatype3.html#determination_of_column_affinity.
+const (
+	classInteger = "integer"
+	classReal    = "real"
+	classText    = "text"
+	classOther   = "other"
+)
+
+// Statuses of the pattern columns against the existing table.
+const (
+	columnSame         = "same"
+	columnCompatible   = "compatible"
+	columnAdd          = "add"
+	columnIncompatible = "incompatible"
+	columnExtra        = "extra"
+)
+
+// errIncompatibleColumns is the error of the columns of the patterns incompatible with the existing table.
+var errIncompatibleColumns = errors.New("incompatible columns")
+
+// tableColumn is a column of an existing table.
+type tableColumn struct {
+	Name string
+	Type string
+}
+
+// columnDiff is the difference of a column between the pattern and the existing table.
+type columnDiff struct {
+	Name        string
+	TableType   string
+	PatternType string
+	Status      string
+}
+
+// EvolveTable creates the table if not exists, or adds the columns of t missing in the existing table
+// by ALTER TABLE. The incompatible column types are refused with the diff, or with versioned,
+// the first of the versioned tables <table>_v2, <table>_v3... created or compatible is used instead.
+func EvolveTable(db *sql.DB, t Table, schema string, versioned bool) (Table, error) {
+	base := t.Name
+
+	for version := 1; ; version++ {
+		if version > 1 {
+			t.Name = fmt.Sprintf("%s_v%d", base, version)
+		}
+
+		err := evolveTable(db, t, schema)
+		if err == nil {
+			return t, nil
+		}
+
+		if !versioned || !errors.Is(err, errIncompatibleColumns) {
+			return t, err
+		}
+
+		log.Printf("%v, try the next version", err)
+	}
+}
+
+func evolveTable(db *sql.DB, t Table, schema string) error {
+	d := DriverDialect(driverName)
+
+	existing, err := describeTable(db, d, t.Name)
+	if err != nil {
+		return fmt.Errorf("describe table %s: %w", t.Name, err)
+	}
+
+	if len(existing) == 0 {
+		createTable, err := t.CreateSQL(d, schema)
+		if err != nil {
+			return err
+		}
+
+		if err := CheckSchema(db, d, schema); err != nil {
+			return err
+		}
+
+		log.Printf("Create table %s", t.Name)
+
+		if _, err := db.Exec(createTable); err != nil {
+			return fmt.Errorf("create table %s: %w", createTable, err)
+		}
+
+		return nil
+	}
+
+	diffs, missing := diffColumns(t, d, existing)
+	changed, incompatible := false, 0
+
+	for _, diff := range diffs {
+		switch diff.Status {
+		case columnSame, columnExtra:
+		case columnIncompatible:
+			incompatible++
+			changed = true
+		default:
+			changed = true
+		}
+	}
+
+	if changed {
+		log.Printf("Columns of the patterns against the existing table %s:", t.Name)
+		printColumnDiffs(diffs)
+	}
+
+	if incompatible > 0 {
+		return fmt.Errorf("%w: %d columns of the patterns are %s with the existing table %s",
+			errIncompatibleColumns, incompatible, columnIncompatible, t.Name)
+	}
+
+	for _, c := range missing {
+		def, err := c.definition(d, schema)
+		if err != nil {
+			return err
+		}
+
+		alter := "ALTER TABLE " + t.Name + " ADD COLUMN " + def
+		log.Print(alter)
+
+		if _, err := db.Exec(alter); err != nil {
+			return fmt.Errorf("%s: %w", alter, err)
+		}
+	}
+
+	return nil
+}
+
+// alterColumnType changes the type of the column of the table. SQLite needs nothing,
+// whose columns store the values of any types by the type affinity.
+func alterColumnType(db *sql.DB, d Dialect, table string, c Column) error {
+	var alter string
+
+	switch d {
+	case MySQL:
+		def, err := c.definition(d, schema)
+		if err != nil {
+			return err
+		}
+
+		alter = "ALTER TABLE " + table + " MODIFY COLUMN " + def
+	case Postgres:
+		alter = "ALTER TABLE " + table + " ALTER COLUMN " + c.Name + " TYPE " + c.typeName(d)
+	default:
+		return nil
+	}
+
+	log.Print(alter)
+
+	if _, err := db.Exec(alter); err != nil {
+		return fmt.Errorf("%s: %w", alter, err)
+	}
+
+	return nil
+}
+
+// describeTable returns the columns of the existing table, empty if the table does not exist.
+func describeTable(db *sql.DB, d Dialect, table string) ([]tableColumn, error) {
+	var (
+		rows *sql.Rows
+		err  error
+	)
+
+	switch d {
+	case MySQL:
+		rows, err = db.Query(`SELECT column_name, column_type FROM information_schema.columns
+WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position`, table)
+	case Postgres:
+		rows, err = db.Query(`SELECT column_name, data_type FROM information_schema.columns
+WHERE table_schema = current_schema() AND table_name = $1 ORDER BY ordinal_position`, strings.ToLower(table))
+	default:
+		rows, err = db.Query(`SELECT name, type FROM pragma_table_info(?)`, table)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []tableColumn
+
+	for rows.Next() {
+		var c tableColumn
+		if err := rows.Scan(&c.Name, &c.Type); err != nil {
+			return nil, err
+		}
+
+		columns = append(columns, c)
+	}
+
+	return columns, rows.Err()
+}
+
+// diffColumns compares the columns of t against the existing columns, and returns the missing ones to add.
+func diffColumns(t Table, d Dialect, existing []tableColumn) (diffs []columnDiff, missing []Column) {
+	tableTypes := make(map[string]string, len(existing))
+	for _, c := range existing {
+		tableTypes[strings.ToLower(c.Name)] = c.Type
+	}
+
+	patternColumns := make(map[string]bool, len(t.Columns))
+
+	for _, c := range t.Columns {
+		patternColumns[strings.ToLower(c.Name)] = true
+		diff := columnDiff{Name: c.Name, PatternType: c.typeName(d)}
+
+		tableType, ok := tableTypes[strings.ToLower(c.Name)]
+		switch {
+		case !ok && c.PrimaryKey:
+			// A primary key can not be added to an existing table.
+			diff.Status = columnIncompatible
+		case !ok:
+			diff.Status = columnAdd
+			missing = append(missing, c)
+		default:
+			diff.TableType = tableType
+			diff.Status = compareTypes(typeClass(tableType), typeClass(diff.PatternType))
+		}
+
+		diffs = append(diffs, diff)
+	}
+
+	for _, c := range existing {
+		if !patternColumns[strings.ToLower(c.Name)] {
+			diffs = append(diffs, columnDiff{Name: c.Name, TableType: c.Type, Status: columnExtra})
+		}
+	}
+
+	return diffs, missing
+}
+
+// compareTypes returns the status of the values of the pattern class stored in the column of the table class.
+// A text column stores anything, and a real column stores integers too.
+func compareTypes(tableClass, patternClass string) string {
+	switch {
+	case tableClass == patternClass:
+		return columnSame
+	case tableClass == classText, tableClass == classReal && patternClass == classInteger:
+		return columnCompatible
+	default:
+		return columnIncompatible
+	}
+}
+
+// typeClass returns the class of the declared type by the rules of the SQLite type affinity.
+func typeClass(declared string) string {
+	t := strings.ToUpper(declared)
+
+	switch {
+	case strings.Contains(t, "INT"):
+		return classInteger
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		return classText
+	case strings.Contains(t, "REAL"), strings.Contains(t, "FLOA"), strings.Contains(t, "DOUB"):
+		return classReal
+	default:
+		return classOther
+	}
+}
+
+func printColumnDiffs(diffs []columnDiff) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "column\ttable\tpattern\tstatus")
+
+	for _, d := range diffs {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Name, d.TableType, d.PatternType, d.Status)
+	}
+
+	_ = w.Flush()
+}
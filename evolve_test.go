@@ -0,0 +1,191 @@
+package sqlite3perf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTypeClass(t *testing.T) {
+	tests := []struct {
+		declared string
+		want     string
+	}{
+		{declared: "INTEGER", want: classInteger},
+		{declared: "bigint(20)", want: classInteger},
+		{declared: "int", want: classInteger},
+		{declared: "varchar(255)", want: classText},
+		{declared: "character varying", want: classText},
+		{declared: "text", want: classText},
+		{declared: "CLOB", want: classText},
+		{declared: "double", want: classReal},
+		{declared: "double precision", want: classReal},
+		{declared: "FLOAT", want: classReal},
+		{declared: "REAL", want: classReal},
+		{declared: "datetime", want: classOther},
+		{declared: "timestamp without time zone", want: classOther},
+		{declared: "", want: classOther},
+	}
+
+	for _, tt := range tests {
+		if got := typeClass(tt.declared); got != tt.want {
+			t.Errorf("typeClass(%s) = %s, want %s", tt.declared, got, tt.want)
+		}
+	}
+}
+
+func TestCompareTypes(t *testing.T) {
+	tests := []struct {
+		table, pattern string
+		want           string
+	}{
+		{table: classInteger, pattern: classInteger, want: columnSame},
+		{table: classText, pattern: classInteger, want: columnCompatible},
+		{table: classText, pattern: classReal, want: columnCompatible},
+		{table: classText, pattern: classOther, want: columnCompatible},
+		{table: classReal, pattern: classInteger, want: columnCompatible},
+		{table: classInteger, pattern: classReal, want: columnIncompatible},
+		{table: classInteger, pattern: classText, want: columnIncompatible},
+		{table: classReal, pattern: classText, want: columnIncompatible},
+		{table: classOther, pattern: classText, want: columnIncompatible},
+	}
+
+	for _, tt := range tests {
+		if got := compareTypes(tt.table, tt.pattern); got != tt.want {
+			t.Errorf("compareTypes(%s, %s) = %s, want %s", tt.table, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestDiffColumns(t *testing.T) {
+	tbl := Table{Name: "t", Columns: []Column{
+		{Name: "id", Type: TypeBigInt, PrimaryKey: true},
+		{Name: "n", Type: TypeInt},
+		{Name: "cost", Type: TypeReal},
+		{Name: "name", Type: TypeVarchar, Size: 64},
+		{Name: "msg", Type: TypeText},
+		{Name: "ts", Type: TypeDatetime},
+	}}
+
+	same := func(d Dialect) []columnDiff {
+		diffs := make([]columnDiff, len(tbl.Columns))
+		for i, c := range tbl.Columns {
+			diffs[i] = columnDiff{Name: c.Name, PatternType: c.typeName(d), Status: columnSame}
+		}
+
+		return diffs
+	}
+
+	withTableTypes := func(diffs []columnDiff, types ...string) []columnDiff {
+		for i := range diffs {
+			diffs[i].TableType = types[i]
+		}
+
+		return diffs
+	}
+
+	tests := []struct {
+		name        string
+		d           Dialect
+		existing    []tableColumn
+		want        []columnDiff
+		wantMissing []string
+	}{
+		{
+			// The types described by each database of the table created by the same columns are the same,
+			// not to create a new versioned table on every run.
+			name: "same by sqlite", d: SQLite,
+			existing: []tableColumn{{"id", "bigint"}, {"n", "int"}, {"cost", "double"}, {"name", "varchar(64)"},
+				{"msg", "text"}, {"ts", "datetime"}},
+			want: withTableTypes(same(SQLite), "bigint", "int", "double", "varchar(64)", "text", "datetime"),
+		},
+		{
+			name: "same by mysql", d: MySQL,
+			existing: []tableColumn{{"id", "bigint(20)"}, {"n", "int(11)"}, {"cost", "double"},
+				{"name", "varchar(64)"}, {"msg", "text"}, {"ts", "datetime"}},
+			want: withTableTypes(same(MySQL), "bigint(20)", "int(11)", "double", "varchar(64)", "text", "datetime"),
+		},
+		{
+			name: "same by postgres", d: Postgres,
+			existing: []tableColumn{{"id", "bigint"}, {"n", "integer"}, {"cost", "double precision"},
+				{"name", "character varying"}, {"msg", "text"}, {"ts", "timestamp without time zone"}},
+			want: withTableTypes(same(Postgres), "bigint", "integer", "double precision", "character varying", "text",
+				"timestamp without time zone"),
+		},
+		{
+			name: "changed", d: SQLite,
+			existing: []tableColumn{{"ID", "INTEGER"}, {"n", "double"}, {"cost", "int"}, {"msg", "text"},
+				{"ts", "text"}, {"old", "text"}},
+			want: []columnDiff{
+				{Name: "id", TableType: "INTEGER", PatternType: "bigint", Status: columnSame},
+				{Name: "n", TableType: "double", PatternType: "int", Status: columnCompatible},
+				{Name: "cost", TableType: "int", PatternType: "double", Status: columnIncompatible},
+				{Name: "name", PatternType: "varchar(64)", Status: columnAdd},
+				{Name: "msg", TableType: "text", PatternType: "text", Status: columnSame},
+				{Name: "ts", TableType: "text", PatternType: "datetime", Status: columnCompatible},
+				{Name: "old", TableType: "text", Status: columnExtra},
+			},
+			wantMissing: []string{"name"},
+		},
+		{
+			name: "primary key missing", d: SQLite,
+			existing: []tableColumn{{"n", "int"}, {"cost", "double"}, {"name", "varchar(64)"}, {"msg", "text"},
+				{"ts", "datetime"}},
+			want: append([]columnDiff{{Name: "id", PatternType: "bigint", Status: columnIncompatible}},
+				withTableTypes(same(SQLite)[1:], "int", "double", "varchar(64)", "text", "datetime")...),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, missing := diffColumns(tbl, tt.d, tt.existing)
+			if !reflect.DeepEqual(diffs, tt.want) {
+				t.Errorf("diffColumns() diffs = %+v, want %+v", diffs, tt.want)
+			}
+
+			var names []string
+			for _, c := range missing {
+				names = append(names, c.Name)
+			}
+
+			if !reflect.DeepEqual(names, tt.wantMissing) {
+				t.Errorf("diffColumns() missing = %v, want %v", names, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestEvolveTable(t *testing.T) {
+	columns := []Column{{Name: "a", Type: TypeText}, {Name: "n", Type: TypeInt}, {Name: "cost", Type: TypeReal}}
+
+	tests := []struct {
+		name      string
+		columns   []Column
+		versioned bool
+		want      string
+		wantErr   bool
+	}{
+		{name: "same", columns: columns, want: "t"},
+		{name: "column added", columns: append(columns[:3:3], Column{Name: "b", Type: TypeText}), want: "t"},
+		{name: "incompatible", columns: []Column{{Name: "n", Type: TypeText}}, wantErr: true},
+		{name: "incompatible versioned", columns: []Column{{Name: "n", Type: TypeText}}, versioned: true, want: "t_v2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, "sqlite3")
+
+			if _, err := EvolveTable(db, Table{Name: "t", Columns: columns}, SchemaDefault, false); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := EvolveTable(db, Table{Name: "t", Columns: tt.columns}, SchemaDefault, tt.versioned)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EvolveTable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && got.Name != tt.want {
+				t.Errorf("EvolveTable() = %s, want %s", got.Name, tt.want)
+			}
+		})
+	}
+}
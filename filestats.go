@@ -0,0 +1,246 @@
+package sqlite3perf
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// FileStats is the space usage of a SQLite database file.
+type FileStats struct {
+	FileSize      int64
+	PageSize      int64
+	PageCount     int64
+	FreelistCount int64
+	// Objects is the page usage of each table and index from the dbstat virtual table, nil when not collected.
+	Objects []ObjectStats
+}
+
+// ObjectStats is the page usage of a table or an index.
+type ObjectStats struct {
+	Name      string
+	Pages     int64
+	LeafPages int64
+	// FragmentedPages is the number of leaf pages not right after the previous leaf page in the key order.
+	FragmentedPages int64
+	Cells           int64
+	Payload         int64
+	Unused          int64
+	Size            int64
+}
+
+// FillFactor returns the ratio of the used bytes in the pages.
+func (o ObjectStats) FillFactor() float64 {
+	if o.Size == 0 {
+		return 0
+	}
+
+	return 1 - float64(o.Unused)/float64(o.Size)
+}
+
+// Fragmentation returns the ratio of the fragmented leaf pages.
+func (o ObjectStats) Fragmentation() float64 {
+	if o.LeafPages == 0 {
+		return 0
+	}
+
+	return float64(o.FragmentedPages) / float64(o.LeafPages)
+}
+
+// CollectFileStats collects the space usage of the SQLite database,
+// with the page usage of each table and index from the dbstat virtual table if withObjects.
+func CollectFileStats(db *sql.DB, withObjects bool) (s FileStats, err error) {
+	for _, p := range []struct {
+		name  string
+		value *int64
+	}{
+		{name: "page_size", value: &s.PageSize},
+		{name: "page_count", value: &s.PageCount},
+		{name: "freelist_count", value: &s.FreelistCount},
+	} {
+		if err := db.QueryRow("PRAGMA " + p.name).Scan(p.value); err != nil {
+			return s, fmt.Errorf("PRAGMA %s: %w", p.name, err)
+		}
+	}
+
+	if f := dbFile(); f != "" {
+		if fi, err := os.Stat(f); err == nil {
+			s.FileSize = fi.Size()
+		}
+	}
+
+	if withObjects {
+		if s.Objects, err = collectObjectStats(db); err != nil {
+			return s, err
+		}
+	}
+
+	return s, nil
+}
+
+// collectObjectStats collects the page usage of each table and index by walking the pages
+// in the dbstat virtual table, which requires SQLite compiled with SQLITE_ENABLE_DBSTAT_VTAB.
+func collectObjectStats(db *sql.DB) ([]ObjectStats, error) {
+	// Pages ordered by path are in the tree order, so are the leaf pages in the key order.
+	rows, err := db.Query(`SELECT name, pageno, pagetype, ncell, payload, unused, pgsize FROM dbstat ORDER BY name, path`)
+	if err != nil {
+		return nil, fmt.Errorf("query dbstat(requires SQLITE_ENABLE_DBSTAT_VTAB): %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		objects  []ObjectStats
+		lastLeaf int64
+	)
+
+	for rows.Next() {
+		var (
+			name, pageType                         string
+			pageNo, cells, payload, unused, pgSize int64
+		)
+
+		if err := rows.Scan(&name, &pageNo, &pageType, &cells, &payload, &unused, &pgSize); err != nil {
+			return nil, err
+		}
+
+		if len(objects) == 0 || objects[len(objects)-1].Name != name {
+			objects = append(objects, ObjectStats{Name: name})
+			lastLeaf = 0
+		}
+
+		o := &objects[len(objects)-1]
+		o.Pages++
+		o.Cells += cells
+		o.Payload += payload
+		o.Unused += unused
+		o.Size += pgSize
+
+		if pageType == "leaf" {
+			if o.LeafPages++; lastLeaf > 0 && pageNo != lastLeaf+1 {
+				o.FragmentedPages++
+			}
+			lastLeaf = pageNo
+		}
+	}
+
+	return objects, rows.Err()
+}
+
+// FillFactor returns the ratio of the used bytes in the pages of all the tables and indexes.
+func (s FileStats) FillFactor() float64 {
+	var total ObjectStats
+	for _, o := range s.Objects {
+		total.Unused += o.Unused
+		total.Size += o.Size
+	}
+
+	return total.FillFactor()
+}
+
+func (s FileStats) String() string {
+	str := fmt.Sprintf("file size %s, page size %d, %d pages, %d free pages(%s)",
+		humanBytes(s.FileSize), s.PageSize, s.PageCount, s.FreelistCount, humanBytes(s.FreelistCount*s.PageSize))
+	if len(s.Objects) > 0 {
+		str += fmt.Sprintf(", fill factor %.2f%%", 100*s.FillFactor())
+	}
+
+	return str
+}
+
+// Print prints the stats with the page usage of each table and index in a table.
+func (s FileStats) Print(w io.Writer) {
+	_, _ = fmt.Fprintln(w, s.String())
+
+	if len(s.Objects) == 0 {
+		return
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintln(tw, "name\tpages\tleaf pages\tfragmented\tcells\tpayload\tsize\tfill factor\t")
+
+	for _, o := range s.Objects {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%.2f%%\t%d\t%s\t%s\t%.2f%%\t\n", o.Name, o.Pages, o.LeafPages,
+			100*o.Fragmentation(), o.Cells, humanBytes(o.Payload), humanBytes(o.Size), 100*o.FillFactor())
+	}
+
+	_ = tw.Flush()
+}
+
+// Diff describes the changes from the stats before to s.
+func (s FileStats) Diff(before FileStats) string {
+	diff := fmt.Sprintf("file size %s -> %s(%+d), pages %d -> %d(%+d), free pages %d -> %d(%+d)",
+		humanBytes(before.FileSize), humanBytes(s.FileSize), s.FileSize-before.FileSize,
+		before.PageCount, s.PageCount, s.PageCount-before.PageCount,
+		before.FreelistCount, s.FreelistCount, s.FreelistCount-before.FreelistCount)
+	if len(s.Objects) > 0 && len(before.Objects) > 0 {
+		diff += fmt.Sprintf(", fill factor %.2f%% -> %.2f%%", 100*before.FillFactor(), 100*s.FillFactor())
+	}
+
+	return diff
+}
+
+// logFileStats logs the space usage of the SQLite database with the title, ignored for other dialects.
+func logFileStats(db *sql.DB, title string) {
+	if DriverDialect(driverName) != SQLite {
+		return
+	}
+
+	s, err := CollectFileStats(db, false)
+	if err != nil {
+		log.Printf("collect file stats error: %v", err)
+		return
+	}
+
+	log.Printf("%s: %s", title, s)
+}
+
+// dbFile returns the file path of the SQLite database in dbPath, empty for in-memory databases.
+func dbFile() string {
+	p := strings.TrimPrefix(dbPath, "file:")
+	if i := strings.IndexByte(p, '?'); i >= 0 {
+		p = p[:i]
+	}
+
+	if p == ":memory:" {
+		return ""
+	}
+
+	return p
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit || m <= -unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.2f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// snapshotFileStats collects the file stats of the SQLite database,
+// with the page usage of each table and index when dbstat is available.
+func snapshotFileStats(db *sql.DB) (FileStats, bool) {
+	if DriverDialect(driverName) != SQLite {
+		return FileStats{}, false
+	}
+
+	s, err := CollectFileStats(db, true)
+	if err != nil {
+		if s, err = CollectFileStats(db, false); err != nil {
+			log.Printf("collect file stats error: %v", err)
+			return s, false
+		}
+	}
+
+	return s, true
+}
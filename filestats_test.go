@@ -0,0 +1,129 @@
+package sqlite3perf
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectFileStats(t *testing.T) {
+	savedPath := dbPath
+	t.Cleanup(func() { dbPath = savedPath })
+
+	tests := []struct {
+		name string
+		// workload runs on the table t(a) after created.
+		workload     string
+		wantPages    bool
+		wantFreelist bool
+	}{
+		{name: "empty table"},
+		{name: "inserted", workload: insertRows, wantPages: true},
+		{name: "deleted", workload: insertRows + "; DELETE FROM t", wantPages: true, wantFreelist: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbPath = filepath.Join(t.TempDir(), "a.db")
+			db := openFileStatsDB(t, tt.workload)
+
+			s, err := CollectFileStats(db, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s.PageSize != 4096 || s.FileSize != s.PageSize*s.PageCount || s.Objects != nil {
+				t.Errorf("CollectFileStats() = %+v, want the file size of the pages of 4096 bytes", s)
+			}
+
+			if (s.PageCount > 2) != tt.wantPages || (s.FreelistCount > 0) != tt.wantFreelist {
+				t.Errorf("CollectFileStats() = %d pages, %d free pages, want more than 2 pages %v, free pages %v",
+					s.PageCount, s.FreelistCount, tt.wantPages, tt.wantFreelist)
+			}
+		})
+	}
+}
+
+func TestAnalyzeFileCmdCollect(t *testing.T) {
+	savedPath := dbPath
+	t.Cleanup(func() { dbPath = savedPath })
+
+	dbPath = filepath.Join(t.TempDir(), "a.db")
+	db := openFileStatsDB(t, insertRows)
+
+	// github.com/mattn/go-sqlite3 is not compiled with the dbstat virtual table.
+	if _, err := CollectFileStats(db, true); err == nil {
+		t.Skip("dbstat is available, no fallback")
+	}
+
+	tests := []struct {
+		name    string
+		objects bool
+	}{
+		{name: "without the objects", objects: false},
+		{name: "fall back without dbstat", objects: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &AnalyzeFileCmd{Objects: tt.objects}
+
+			s, err := g.collect(db)
+			if err != nil || s.PageCount == 0 || s.Objects != nil {
+				t.Errorf("collect() = %+v, %v, want the file stats without the objects", s, err)
+			}
+		})
+	}
+}
+
+func TestObjectStats(t *testing.T) {
+	tests := []struct {
+		name          string
+		o             ObjectStats
+		fillFactor    float64
+		fragmentation float64
+	}{
+		{name: "empty"},
+		{name: "half used", o: ObjectStats{LeafPages: 4, Unused: 4096, Size: 8192}, fillFactor: 0.5},
+		{name: "fragmented", o: ObjectStats{LeafPages: 4, FragmentedPages: 1, Size: 4096}, fillFactor: 1,
+			fragmentation: 0.25},
+	}
+
+	for _, tt := range tests {
+		if got := tt.o.FillFactor(); got != tt.fillFactor {
+			t.Errorf("%s FillFactor() = %v, want %v", tt.name, got, tt.fillFactor)
+		}
+
+		if got := tt.o.Fragmentation(); got != tt.fragmentation {
+			t.Errorf("%s Fragmentation() = %v, want %v", tt.name, got, tt.fragmentation)
+		}
+	}
+}
+
+// insertRows inserts 1000 rows of 100 bytes into t.
+const insertRows = `WITH RECURSIVE k(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM k WHERE i < 1000)
+INSERT INTO t SELECT randomblob(100) FROM k`
+
+// openFileStatsDB opens the database of dbPath, and runs the workload on the table t(a) created.
+func openFileStatsDB(t *testing.T, workload string) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	if _, err := db.Exec("PRAGMA page_size=4096; CREATE TABLE t(a BLOB)"); err != nil {
+		t.Fatal(err)
+	}
+
+	if workload != "" {
+		if _, err := db.Exec(workload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return db
+}
@@ -0,0 +1,381 @@
+package sqlite3perf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// RecordParser parses the lines of the records into the values by the column names.
+type RecordParser interface {
+	// Lines returns the number of the lines of a record, each line parsed by its index in the record.
+	Lines() int
+	// Parse parses the line of the index in the record.
+	Parse(idx int, line []byte) (map[string]interface{}, bool)
+}
+
+// Format is a built-in log format selected by --format instead of the pattern file.
+type Format struct {
+	Name string
+	// Start is the sample of the line start of the multi-lines records, empty for a record per line.
+	Start string
+	// Columns are the columns of the records, nil for the columns extracted dynamically by the keys of the records.
+	Columns []Column
+	Parser  RecordParser
+}
+
+// combinedColumns are the columns of the combined and common access log of nginx and Apache.
+// nolint:gochecknoglobals
+var combinedColumns = []Column{
+	{Name: "remote_addr", Type: TypeVarchar, Size: 64},
+	{Name: "remote_user", Type: TypeText},
+	{Name: "time_local", Type: TypeVarchar, Size: 32},
+	{Name: "method", Type: TypeVarchar, Size: 16},
+	{Name: "path", Type: TypeText},
+	{Name: "protocol", Type: TypeVarchar, Size: 16},
+	{Name: "status", Type: TypeInt},
+	{Name: "body_bytes_sent", Type: TypeBigInt},
+	{Name: "http_referer", Type: TypeText},
+	{Name: "http_user_agent", Type: TypeText},
+}
+
+// formats are the built-in formats by the names.
+// nolint:gochecknoglobals
+var formats = map[string]*Format{
+	"nginx":  combinedFormat("nginx"),
+	"apache": combinedFormat("apache"),
+	"golog": regexFormat("golog", "2021/05/29 13:09:46", []Column{
+		{Name: "time", Type: TypeVarchar, Size: 26},
+		{Name: "file", Type: TypeVarchar, Size: 255},
+		{Name: "message", Type: TypeText},
+	}, `^(?P<time>\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?) (?:(?P<file>[^\s:]+\.go:\d+): )?`+
+		`(?P<message>(?s:.*))$`, nil),
+	"rfc3164": regexFormat("rfc3164", "", []Column{
+		{Name: "facility", Type: TypeInt},
+		{Name: "severity", Type: TypeInt},
+		{Name: "timestamp", Type: TypeVarchar, Size: 32},
+		{Name: "host", Type: TypeVarchar, Size: 255},
+		{Name: "app", Type: TypeVarchar, Size: 48},
+		{Name: "pid", Type: TypeBigInt},
+		{Name: "message", Type: TypeText},
+	}, `^(?:<(?P<pri>\d{1,3})>)?(?P<timestamp>[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}) (?P<host>\S+) `+
+		`(?:(?P<app>[^\s\[:]+)(?:\[(?P<pid>\d+)\])?: )?(?P<message>(?s:.*))$`, splitPriority),
+	"rfc5424": regexFormat("rfc5424", "", []Column{
+		{Name: "facility", Type: TypeInt},
+		{Name: "severity", Type: TypeInt},
+		{Name: "version", Type: TypeInt},
+		{Name: "timestamp", Type: TypeVarchar, Size: 35},
+		{Name: "host", Type: TypeVarchar, Size: 255},
+		{Name: "app", Type: TypeVarchar, Size: 48},
+		{Name: "procid", Type: TypeVarchar, Size: 128},
+		{Name: "msgid", Type: TypeVarchar, Size: 32},
+		{Name: "structured_data", Type: TypeText},
+		{Name: "message", Type: TypeText},
+	}, `^<(?P<pri>\d{1,3})>(?P<version>\d{1,2}) (?P<timestamp>\S+) (?P<host>\S+) (?P<app>\S+) (?P<procid>\S+) `+
+		`(?P<msgid>\S+) (?P<structured_data>-|(?:\[(?:[^\]\\]|\\.)*\])+)(?: \x{FEFF}?(?P<message>(?s:.*)))?$`,
+		splitPriority),
+	"logfmt": {Name: "logfmt", Parser: logfmtParser{}},
+	"jsonl":  {Name: "jsonl", Parser: jsonParser{}},
+}
+
+func combinedFormat(name string) *Format {
+	return regexFormat(name, "", combinedColumns, `^(?P<remote_addr>\S+) \S+ (?P<remote_user>\S+) `+
+		`\[(?P<time_local>[^\]]+)\] "(?:(?P<method>[A-Z]+) (?P<path>\S+)(?: (?P<protocol>[^"]*))?|[^"]*)" `+
+		`(?P<status>\d{3}) (?P<body_bytes_sent>\d+|-)(?: "(?P<http_referer>[^"]*)" "(?P<http_user_agent>[^"]*)")?`, nil)
+}
+
+func regexFormat(name, start string, columns []Column, expr string, post func(map[string]interface{})) *Format {
+	return &Format{Name: name, Start: start, Columns: columns, Parser: newRegexParser(expr, columns, post)}
+}
+
+// FormatNames returns the names of the built-in formats.
+func FormatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// LookupFormat returns the built-in format of the name.
+func LookupFormat(name string) (*Format, error) {
+	if f, ok := formats[name]; ok {
+		return f, nil
+	}
+
+	return nil, fmt.Errorf("unknown format %s, should be one of %s", name, strings.Join(FormatNames(), ", "))
+}
+
+// regexParser parses a record per line by the named groups of the regular expression, - or empty as NULL.
+// The values of the groups of the integer columns are converted to int64.
+type regexParser struct {
+	re   *regexp.Regexp
+	ints map[string]bool
+	// post adjusts the values parsed.
+	post func(values map[string]interface{})
+}
+
+func newRegexParser(expr string, columns []Column, post func(values map[string]interface{})) *regexParser {
+	p := &regexParser{re: regexp.MustCompile(expr), ints: make(map[string]bool), post: post}
+
+	for _, c := range columns {
+		if c.Type == TypeInt || c.Type == TypeBigInt {
+			p.ints[c.Name] = true
+		}
+	}
+
+	return p
+}
+
+func (p *regexParser) Lines() int { return 1 }
+
+func (p *regexParser) Parse(_ int, line []byte) (map[string]interface{}, bool) {
+	m := p.re.FindSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+
+	values := make(map[string]interface{}, len(m))
+
+	for i, name := range p.re.SubexpNames() {
+		if name == "" || len(m[i]) == 0 || string(m[i]) == "-" {
+			continue
+		}
+
+		if p.ints[name] {
+			values[name], _ = strconv.ParseInt(string(m[i]), 10, 64)
+		} else {
+			values[name] = string(m[i])
+		}
+	}
+
+	if p.post != nil {
+		p.post(values)
+	}
+
+	return values, true
+}
+
+// splitPriority splits the syslog priority into the facility and the severity.
+func splitPriority(values map[string]interface{}) {
+	if pri, ok := values["pri"].(string); ok {
+		n, _ := strconv.Atoi(pri)
+		values["facility"], values["severity"] = n/8, n%8
+		delete(values, "pri")
+	}
+}
+
+// logfmtParser parses a record per line of the key=value pairs, the values are quoted optionally.
+type logfmtParser struct{}
+
+func (logfmtParser) Lines() int { return 1 }
+
+func (logfmtParser) Parse(_ int, line []byte) (map[string]interface{}, bool) {
+	values := make(map[string]interface{})
+	pairs := 0
+
+	for s := string(line); s != ""; {
+		s = strings.TrimLeftFunc(s, unicode.IsSpace)
+
+		end := strings.IndexFunc(s, func(r rune) bool { return r == '=' || unicode.IsSpace(r) })
+		if end < 0 {
+			end = len(s)
+		}
+
+		key := s[:end]
+		s = s[end:]
+
+		if !strings.HasPrefix(s, "=") { // a key alone is a flag.
+			if key != "" {
+				setDynamic(values, key, true)
+			}
+
+			continue
+		}
+
+		value, rest, ok := logfmtValue(s[1:])
+		if !ok || key == "" {
+			return nil, false
+		}
+
+		setDynamic(values, key, inferValue(value))
+		s, pairs = rest, pairs+1
+	}
+
+	// The lines of the plain text are not logfmt, even though the words look like the flags.
+	return values, pairs > 0
+}
+
+// logfmtValue returns the value at the start of s, unquoted if quoted, and the rest of s.
+func logfmtValue(s string) (value, rest string, ok bool) {
+	if !strings.HasPrefix(s, `"`) {
+		end := strings.IndexFunc(s, unicode.IsSpace)
+		if end < 0 {
+			return s, "", true
+		}
+
+		return s[:end], s[end:], true
+	}
+
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			value, err := strconv.Unquote(s[:i+1])
+			return value, s[i+1:], err == nil
+		}
+	}
+
+	return "", "", false
+}
+
+// inferValue converts the value to int64 or float64 if it is a number.
+func inferValue(s string) interface{} {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+
+	return s
+}
+
+// jsonParser parses a record per line of a JSON object, the nested objects are flattened
+// with their keys joined by _, and the arrays are kept as JSON.
+type jsonParser struct{}
+
+func (jsonParser) Lines() int { return 1 }
+
+func (jsonParser) Parse(_ int, line []byte) (map[string]interface{}, bool) {
+	d := json.NewDecoder(bytes.NewReader(line))
+	d.UseNumber()
+
+	var obj map[string]interface{}
+	if err := d.Decode(&obj); err != nil {
+		return nil, false
+	}
+
+	values := make(map[string]interface{}, len(obj))
+	flattenJSON(values, "", obj)
+
+	return values, len(values) > 0
+}
+
+func flattenJSON(values map[string]interface{}, prefix string, obj map[string]interface{}) {
+	for k, v := range obj {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			flattenJSON(values, prefix+k+"_", v)
+		case []interface{}:
+			b, _ := json.Marshal(v)
+			setDynamic(values, prefix+k, string(b))
+		case json.Number:
+			setDynamic(values, prefix+k, inferValue(v.String()))
+		default: // string, bool or nil
+			setDynamic(values, prefix+k, v)
+		}
+	}
+}
+
+// setDynamic sets the value by the column name of the key, the bools are stored as 1 and 0.
+func setDynamic(values map[string]interface{}, key string, v interface{}) {
+	if b, ok := v.(bool); ok {
+		v = int64(0)
+		if b {
+			v = int64(1)
+		}
+	}
+
+	if name := columnName(key); name != "" {
+		values[name] = v
+	}
+}
+
+// reservedNames are the SQL keywords which can not be the column names unquoted, prefixed by _.
+// nolint:gochecknoglobals
+var reservedNames = map[string]bool{
+	"all": true, "and": true, "as": true, "by": true, "case": true, "check": true, "column": true,
+	"create": true, "default": true, "delete": true, "desc": true, "distinct": true, "drop": true, "else": true,
+	"from": true, "group": true, "having": true, "in": true, "index": true, "insert": true, "into": true,
+	"is": true, "join": true, "key": true, "limit": true, "not": true, "null": true, "on": true, "or": true,
+	"order": true, "primary": true, "references": true, "select": true, "table": true, "to": true, "union": true,
+	"unique": true, "update": true, "user": true, "values": true, "when": true, "where": true,
+}
+
+// columnName returns the column name of the key, lower cased with the characters other than letters,
+// digits and _ replaced by _, prefixed by _ if starts with a digit or reserved, at most 64 characters.
+func columnName(key string) string {
+	b := make([]byte, 0, len(key))
+
+	for _, c := range strings.ToLower(key) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '_':
+			b = append(b, byte(c))
+		default:
+			b = append(b, '_')
+		}
+	}
+
+	name := strings.Trim(string(b), "_")
+	if name == "" {
+		return ""
+	}
+
+	if name[0] >= '0' && name[0] <= '9' || reservedNames[name] {
+		name = "_" + name
+	}
+
+	if len(name) > 64 {
+		name = name[:64]
+	}
+
+	return name
+}
+
+// dynamicColumn returns the column of the value of the key seen first.
+func dynamicColumn(name string, v interface{}) Column {
+	switch v.(type) {
+	case int64:
+		return Column{Name: name, Type: TypeBigInt}
+	case float64:
+		return Column{Name: name, Type: TypeReal}
+	default:
+		return Column{Name: name, Type: TypeText}
+	}
+}
+
+// widenColumn returns the column widened to store the value drifted from the type of the column,
+// an integer column to real for a float, and a column other than text to text for a string.
+func widenColumn(c Column, v interface{}) (Column, bool) {
+	switch v.(type) {
+	case float64:
+		if c.Type != TypeInt && c.Type != TypeBigInt {
+			return c, false
+		}
+
+		c.Type = TypeReal
+	case string:
+		if textColumn(c) {
+			return c, false
+		}
+
+		c.Type = TypeText
+	default:
+		return c, false
+	}
+
+	return c, true
+}
+
+func textColumn(c Column) bool { return c.Type == TypeText || c.Type == TypeVarchar }
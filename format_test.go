@@ -0,0 +1,146 @@
+package sqlite3perf
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFormatParse(t *testing.T) {
+	type values = map[string]interface{}
+
+	tests := []struct {
+		name   string
+		format string
+		line   string
+		want   values
+		ok     bool
+	}{
+		{
+			name: "nginx combined", format: "nginx",
+			line: `127.0.0.1 - frank [29/May/2021:13:09:46 +0800] "GET /a?b=1 HTTP/1.1" 200 612 "-" "curl/7.68.0"`,
+			want: values{"remote_addr": "127.0.0.1", "remote_user": "frank", "time_local": "29/May/2021:13:09:46 +0800",
+				"method": "GET", "path": "/a?b=1", "protocol": "HTTP/1.1", "status": int64(200),
+				"body_bytes_sent": int64(612), "http_user_agent": "curl/7.68.0"},
+			ok: true,
+		},
+		{
+			name: "apache common with bad request", format: "apache",
+			line: `10.0.0.1 - - [29/May/2021:13:09:46 +0800] "\x16\x03" 400 -`,
+			want: values{"remote_addr": "10.0.0.1", "time_local": "29/May/2021:13:09:46 +0800", "status": int64(400)},
+			ok:   true,
+		},
+		{name: "nginx not matched", format: "nginx", line: "hello world"},
+		{
+			name: "golog with file", format: "golog",
+			line: "2021/05/29 13:09:46.123 main.go:42: started\n  more",
+			want: values{"time": "2021/05/29 13:09:46.123", "file": "main.go:42", "message": "started\n  more"},
+			ok:   true,
+		},
+		{
+			name: "golog without file", format: "golog",
+			line: "2021/05/29 13:09:46 started",
+			want: values{"time": "2021/05/29 13:09:46", "message": "started"},
+			ok:   true,
+		},
+		{
+			name: "rfc3164", format: "rfc3164",
+			line: "<34>May  9 13:09:46 host su[123]: 'su root' failed",
+			want: values{"facility": 4, "severity": 2, "timestamp": "May  9 13:09:46", "host": "host", "app": "su",
+				"pid": int64(123), "message": "'su root' failed"},
+			ok: true,
+		},
+		{
+			name: "rfc5424", format: "rfc5424",
+			line: `<165>1 2021-05-29T13:09:46.003Z host app - ID47 [a b="\]"] hello`,
+			want: values{"facility": 20, "severity": 5, "version": int64(1), "timestamp": "2021-05-29T13:09:46.003Z",
+				"host": "host", "app": "app", "msgid": "ID47", "structured_data": `[a b="\]"]`, "message": "hello"},
+			ok: true,
+		},
+		{
+			name: "logfmt", format: "logfmt",
+			line: `level=info msg="hello \"world\"" took=1.5 n=3 cached User-ID=x`,
+			want: values{"level": "info", "msg": `hello "world"`, "took": 1.5, "n": int64(3), "cached": int64(1),
+				"user_id": "x"},
+			ok: true,
+		},
+		{name: "logfmt of plain text", format: "logfmt", line: "hello world"},
+		{name: "logfmt unterminated quote", format: "logfmt", line: `msg="hello`},
+		{
+			name: "jsonl nested", format: "jsonl",
+			line: `{"http":{"status":200,"ok":true},"tags":["a","b"],"Order":1.5,"user":null}`,
+			want: values{"http_status": int64(200), "http_ok": int64(1), "tags": `["a","b"]`, "_order": 1.5,
+				"_user": nil},
+			ok: true,
+		},
+		{
+			// The records of only nulls are parsed, and rejected by the assembler of the dynamic columns.
+			name: "jsonl only nulls", format: "jsonl", line: `{"a":null}`, want: values{"a": nil}, ok: true,
+		},
+		{name: "jsonl empty object", format: "jsonl", line: `{}`, want: values{}},
+		{name: "jsonl not an object", format: "jsonl", line: `[1,2]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := LookupFormat(tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := f.Parser.Parse(0, []byte(tt.line))
+			if ok != tt.ok {
+				t.Fatalf("Parse(%s) ok = %v, want %v", tt.line, ok, tt.ok)
+			}
+
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%s) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := []struct{ key, want string }{
+		{key: "Status", want: "status"},
+		{key: "user.name", want: "user_name"},
+		{key: "-x-", want: "x"},
+		{key: "2xx", want: "_2xx"},
+		{key: "order", want: "_order"},
+		{key: "@@", want: ""},
+		{key: "a123456789b123456789c123456789d123456789e123456789f123456789g123456789",
+			want: "a123456789b123456789c123456789d123456789e123456789f123456789g123"},
+	}
+
+	for _, tt := range tests {
+		if got := columnName(tt.key); got != tt.want {
+			t.Errorf("columnName(%s) = %s, want %s", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestWidenColumn(t *testing.T) {
+	tests := []struct {
+		name  string
+		c     Column
+		v     interface{}
+		want  ColumnType
+		widen bool
+	}{
+		{name: "int by int", c: Column{Type: TypeBigInt}, v: int64(1), want: TypeBigInt},
+		{name: "int by float", c: Column{Type: TypeBigInt}, v: 1.5, want: TypeReal, widen: true},
+		{name: "int by string", c: Column{Type: TypeBigInt}, v: "x", want: TypeText, widen: true},
+		{name: "real by int", c: Column{Type: TypeReal}, v: int64(1), want: TypeReal},
+		{name: "real by string", c: Column{Type: TypeReal}, v: "x", want: TypeText, widen: true},
+		{name: "text by float", c: Column{Type: TypeText}, v: 1.5, want: TypeText},
+		{name: "varchar by string", c: Column{Type: TypeVarchar}, v: "x", want: TypeVarchar},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, widen := widenColumn(tt.c, tt.v)
+			if got.Type != tt.want || widen != tt.widen {
+				t.Errorf("widenColumn() = %v, %v, want %v, %v", got.Type, widen, tt.want, tt.widen)
+			}
+		})
+	}
+}
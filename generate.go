@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"go.uber.org/atomic"
@@ -11,6 +12,7 @@ import (
 	"github.com/spf13/pflag"
 
 	_ "github.com/go-sql-driver/mysql" // import mysql driver
+	_ "github.com/jackc/pgx/v4/stdlib" // import pgx driver of PostgreSQL
 	_ "github.com/mattn/go-sqlite3"    // import sqlite3 driver
 	"github.com/spf13/cobra"
 	_ "modernc.org/sqlite" // import CGo-free port of SQLite/SQLite3.
@@ -24,8 +26,14 @@ type GenerateCmd struct {
 	// Prepared use sql.DB Prepared statement for later queries or executions.
 	Prepared   bool
 	LogSeconds int
+	Conflict   ConflictOptions
+	// AutoVacuum is the PRAGMA auto_vacuum(NONE/FULL/INCREMENTAL) set before the table is created.
+	AutoVacuum string
+	// DeleteRatio is the ratio of the generated records to delete after inserts, to experiment with auto_vacuum.
+	DeleteRatio float64
 
 	currentSeq *atomic.Uint32
+	deletes    MutateCmd
 }
 
 // nolint:gochecknoinits
@@ -55,12 +63,44 @@ func (g *GenerateCmd) initFlags(f *pflag.FlagSet) {
 	f.IntVarP(&g.LogSeconds, "interval", "i", 2, "interval seconds between progress messages")
 	f.BoolVarP(&g.Vacuum, "vacuum", "v", false, "VACUUM database file after the records generated.")
 	f.BoolVarP(&g.Prepared, "prepared", "p", false, "use sql.DB Prepared statement for later queries or executions.")
+	g.Conflict.initFlags(f)
+	f.StringVar(&g.AutoVacuum, "auto-vacuum", "", "PRAGMA auto_vacuum(NONE/FULL/INCREMENTAL) set before the table created")
+	f.Float64Var(&g.DeleteRatio, "delete-ratio", 0, "ratio(0-1) of the records to delete by key ranges after inserts")
+	f.IntVar(&g.deletes.RangeSize, "delete-range", 10, "number of keys in a range to delete")
+	g.deletes.initIncrementalFlags(f)
 }
 
 func (g *GenerateCmd) run(cmd *cobra.Command, args []string) {
+	g.Run()
+}
+
+// Run generates the records, and returns the elapsed time of the inserts.
+func (g *GenerateCmd) Run() (elapsed time.Duration) {
 	log.Printf("Generating records by config %+v", g)
 
-	db := setupBench(true, 1)
+	if t, ok := tables[table]; ok {
+		if err := g.Conflict.validate(t); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if g.DeleteRatio != 0 {
+		g.deletes.Ratio = g.DeleteRatio
+		if err := g.deletes.validate("delete-ratio", "delete-range"); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var createPragmas []string
+	if g.AutoVacuum != "" {
+		p := "auto_vacuum=" + strings.ToUpper(g.AutoVacuum)
+		if _, err := ParsePragma(p, false); err != nil {
+			log.Fatal(err)
+		}
+		createPragmas = append(createPragmas, p)
+	}
+
+	db := setupBench(true, 1, createPragmas...)
 	defer db.Close()
 
 	// Preinitialize i so that we can use it in a goroutine to give proper feedback
@@ -73,12 +113,18 @@ func (g *GenerateCmd) run(cmd *cobra.Command, args []string) {
 
 	if g.NumRecs > 0 {
 		go g.inserts(db, done)
-		g.progressLogging(start, done)
+		elapsed = g.progressLogging(start, done)
+	}
+
+	if g.DeleteRatio > 0 {
+		g.deletePhase(db)
 	}
 
 	if g.Vacuum {
 		vacuumDB(db)
 	}
+
+	return elapsed
 }
 
 // nolint:gomnd,gosec
@@ -88,19 +134,11 @@ func (g *GenerateCmd) inserts(db *sql.DB, done chan bool) {
 		log.Fatalf("%s does not exist", table)
 	}
 
-	// MySQL 协议定义两个字节表示传输参数个数，因此最大值是2^16-1=65536
-	// 防止出现错误：failed Error 1390: Prepared statement contains too many placeholders
-	// The prepared statement protocol defines a signed `2 bytes` short to describe the number of parameters
-	// that will be retrieved from the server. The client firstly calls COM_STMT_PREPARE,
-	// for which it receives a COM_STMT_PREPARE response if successful.
-	if driverName == "mysql" && g.BatchSize*t.InsertFieldsNum > 65535 {
-		batchSize := 65535 / t.InsertFieldsNum
-		log.Printf("adjust batch size to %d", batchSize)
-		g.BatchSize = batchSize
-	}
+	d := DriverDialect(driverName)
+	g.BatchSize = adjustBatchSize(db, d, g.BatchSize, t.InsertFieldsNum())
 
 	// Prepare values needed so that there aren't any allocations done in the loop
-	query := t.CreateInsertSQL(g.BatchSize)
+	query := t.CreateInsertSQL(d, g.Conflict.Mode, g.BatchSize)
 	execFn := func(args ...interface{}) (sql.Result, error) { return db.Exec(query, args...) }
 
 	if g.Prepared {
@@ -120,30 +158,55 @@ func (g *GenerateCmd) inserts(db *sql.DB, done chan bool) {
 	log.Print("Starting inserts")
 
 	args := make([]interface{}, 0, g.BatchSize*3)
+	keys := newOverlapKeys(g.Conflict.Overlap, g.BatchSize)
 
 	g.currentSeq.Load()
 
 	for i := int(g.currentSeq.Load()); i < g.NumRecs; i = int(g.currentSeq.Add(1)) {
-		args = append(args, t.Generator(i)...)
+		args = append(args, t.Generator(keys.Next(i))...)
 
-		if len(args) == g.BatchSize*t.InsertFieldsNum {
+		if len(args) == g.BatchSize*t.InsertFieldsNum() {
 			if _, err := execFn(args...); err != nil {
 				log.Fatalf("Inserting values into database failed: %s", err)
 			}
 
 			args = args[0:0]
 		} else if lastNum > 0 && i+1 == g.NumRecs {
-			query := t.CreateInsertSQL(lastNum)
+			query := t.CreateInsertSQL(d, g.Conflict.Mode, lastNum)
 			if _, err := db.Exec(query, args...); err != nil {
 				log.Fatalf("Inserting values into database failed: %s", err)
 			}
 		}
 	}
 
+	if keys.conflicts > 0 {
+		log.Printf("%d of %d records generated with conflicting keys, conflict mode %s",
+			keys.conflicts, g.NumRecs, g.Conflict.Mode)
+	}
+
 	// Signal the progress log that we are done
 	done <- true
 }
 
+// deletePhase deletes the DeleteRatio of the records by key ranges in a random order,
+// with the periodic incremental_vacuum if configured, and reports the space reclaimed.
+func (g *GenerateCmd) deletePhase(db *sql.DB) {
+	autoVacuum, _ := QueryPragmaValue(db, "auto_vacuum")
+	log.Printf("Deleting %.2f%% of the records with auto_vacuum=%s", 100*g.DeleteRatio, autoVacuum)
+
+	before, _ := CollectFileStats(db, false)
+
+	g.deletes.Delete = true
+	g.deletes.Mode = MutateRange
+	g.deletes.Ratio = g.DeleteRatio
+	g.deletes.LogSeconds = g.LogSeconds
+	g.deletes.Run(db, tables[table])
+
+	if after, err := CollectFileStats(db, false); err == nil {
+		log.Printf("Deletes with auto_vacuum=%s changed %s", autoVacuum, after.Diff(before))
+	}
+}
+
 func abbreviate(s string, maxSize int) string {
 	if len(s) < maxSize {
 		return s
@@ -156,15 +219,37 @@ func abbreviate(s string, maxSize int) string {
 	return s[:maxSize-3] + "..."
 }
 
+func (g *GenerateCmd) progressLogging(start time.Time, done chan bool) time.Duration {
+	return progressLogging(start, done, g.NumRecs, g.currentSeq, g.LogSeconds, "written")
+}
+
+// progressLogging logs the progress of the current/total records every logSeconds until done is signaled,
+// and returns the total duration. The total is unknown in advance if 0, like the records parsed from a log.
 // nolint:gomnd
-func (g *GenerateCmd) progressLogging(start time.Time, done chan bool) {
+func progressLogging(start time.Time, done chan bool, total int, current *atomic.Uint32, logSeconds int,
+	verb string) time.Duration {
 	log.Print("Starting progress logging")
 
-	l := len(fmt.Sprintf("%d", g.NumRecs))
+	l := len(fmt.Sprintf("%d", total))
 	// Precalculate the percentage each record represents
-	p := float64(100) / float64(g.NumRecs)
+	p := float64(100) / float64(total)
+
+	logProgress := func(i int) {
+		dur := time.Since(start)
+		avg := time.Duration(0)
+		if i > 0 {
+			avg = time.Duration(dur.Nanoseconds() / int64(i))
+		}
 
-	ticker := time.NewTicker(time.Duration(g.LogSeconds) * time.Second)
+		if total > 0 {
+			log.Printf("%*d/%*d (%6.2f%%) %s in %s, avg: %s/record, %2.2f records/s",
+				l, i, l, total, p*float64(i), verb, dur, avg, float64(i)/dur.Seconds())
+		} else {
+			log.Printf("%d %s in %s, avg: %s/record, %2.2f records/s", i, verb, dur, avg, float64(i)/dur.Seconds())
+		}
+	}
+
+	ticker := time.NewTicker(time.Duration(logSeconds) * time.Second)
 	defer ticker.Stop()
 
 out:
@@ -173,23 +258,31 @@ out:
 		// Since this is a time consuming process depending on the number of
 		// records	created, we want some feedback every 2 seconds
 		case <-ticker.C:
-			dur := time.Since(start)
-			i := g.currentSeq.Load()
-			log.Printf("%*d/%*d (%6.2f%%) written in %s, avg: %s/record, %2.2f records/s",
-				l, i, l, g.NumRecs, p*float64(i), dur,
-				time.Duration(dur.Nanoseconds()/int64(i)), float64(i)/dur.Seconds())
+			if i := current.Load(); i > 0 {
+				logProgress(int(i))
+			}
 		case <-done:
 			break out
 		}
 	}
 
 	dur := time.Since(start)
-	log.Printf("%*d/%*d (%6.2f%%) written in %s, avg: %s/record, %2.2f records/s",
-		l, g.NumRecs, l, g.NumRecs, p*float64(g.NumRecs), dur,
-		time.Duration(dur.Nanoseconds()/int64(g.NumRecs)), float64(g.NumRecs)/dur.Seconds())
+
+	if total > 0 {
+		logProgress(total)
+	} else {
+		logProgress(int(current.Load()))
+	}
+
+	return dur
 }
 
 func vacuumDB(db *sql.DB) {
+	before, ok := snapshotFileStats(db)
+	if ok {
+		log.Printf("Before vacuum: %s", before)
+	}
+
 	log.Print("Vaccum database file")
 
 	start := time.Now()
@@ -201,4 +294,9 @@ func vacuumDB(db *sql.DB) {
 
 	since := time.Since(start)
 	log.Printf("Vacuum took %s", since)
+
+	if after, ok2 := snapshotFileStats(db); ok && ok2 {
+		log.Printf("After vacuum: %s", after)
+		log.Printf("Vacuum changed %s", after.Diff(before))
+	}
 }
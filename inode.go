@@ -0,0 +1,17 @@
+//go:build !windows
+
+package sqlite3perf
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileInode returns the inode of the file.
+func fileInode(fi os.FileInfo) uint64 {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino) // nolint:unconvert // int64 on some platforms
+	}
+
+	return 0
+}
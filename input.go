@@ -0,0 +1,427 @@
+package sqlite3perf
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Orders of the files matched by the glob pattern.
+const (
+	OrderName  = "name"
+	OrderMtime = "mtime"
+)
+
+// headSize is the max size of the head of a file hashed to identify the file.
+const headSize = 4096
+
+// InputOptions is the options to open the input files.
+type InputOptions struct {
+	// Order is the order of the files matched by the glob pattern, name or mtime.
+	Order string
+	// Follow tails the last file, across the rotations, until the context canceled.
+	Follow bool
+	// Poll is the interval to check the growth and the rotation of the followed file.
+	Poll time.Duration
+}
+
+// FileID identifies a file, even if it is renamed by the rotation.
+type FileID struct {
+	Path  string
+	Inode uint64
+	Size  int64
+	// HeadSize is the size of the head of the file hashed, at most 4096 bytes.
+	HeadSize int
+	HeadHash string
+}
+
+// Inputs yields the input files one by one, - for stdin, or the files matched by a glob pattern in the order.
+type Inputs struct {
+	// Resume returns the offset of the file to resume from, nil to read all the files from the start.
+	Resume func(f *os.File, id FileID) int64
+
+	ctx   context.Context
+	stdin bool
+	// stdinReader is the decompressed stdin buffered, peeked by Sample.
+	stdinReader *bufio.Reader
+	files       []string
+	options     InputOptions
+	last        *InputFile
+}
+
+// InputFile is an input file, whose gzip, bzip2 and zstd compressed content is decompressed,
+// detected by the magic numbers.
+type InputFile struct {
+	Name string
+	// ID identifies the file, zero for stdin.
+	ID FileID
+	// Offset is the offset of the (decompressed) content the reading starts from.
+	Offset int64
+
+	r       io.Reader
+	closers []io.Closer
+	follow  *followReader
+}
+
+func (f *InputFile) Read(p []byte) (int, error) { return f.r.Read(p) }
+
+func (f *InputFile) Close() error {
+	for i := len(f.closers) - 1; i >= 0; i-- {
+		_ = f.closers[i].Close()
+	}
+
+	return nil
+}
+
+// OpenInputs opens the inputs of file, - for stdin, or a glob pattern of the files.
+func OpenInputs(ctx context.Context, file string, o InputOptions) (*Inputs, error) {
+	if file == "-" {
+		if o.Follow {
+			return nil, fmt.Errorf("--follow is not supported by stdin")
+		}
+
+		return &Inputs{ctx: ctx, stdin: true, options: o}, nil
+	}
+
+	files, err := inputFiles(file, o.Order)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Inputs{ctx: ctx, files: files, options: o}, nil
+}
+
+// Next opens the next input file, or the new file of the followed one rotated, io.EOF when no more.
+func (s *Inputs) Next() (in *InputFile, err error) {
+	defer func() { s.last = in }()
+
+	switch {
+	case s.last != nil && s.last.follow != nil && s.last.follow.rotated:
+		return s.open(s.last.Name, true)
+	case s.stdin:
+		s.stdin = false
+		log.Print("Reading stdin")
+
+		if s.stdinReader != nil {
+			return &InputFile{Name: "-", r: s.stdinReader}, nil
+		}
+
+		r, err := decompress(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("read stdin: %w", err)
+		}
+
+		return &InputFile{Name: "-", r: r}, nil
+	case len(s.files) == 0:
+		return nil, io.EOF
+	default:
+		file := s.files[0]
+		s.files = s.files[1:]
+
+		return s.open(file, s.options.Follow && len(s.files) == 0)
+	}
+}
+
+// Sample returns the first n bytes at most of the (decompressed) content of the first input, not consumed.
+// The sample of stdin is peeked, and waits for n bytes or EOF.
+func (s *Inputs) Sample(n int) ([]byte, error) {
+	if s.stdin {
+		if s.stdinReader == nil {
+			r, err := decompress(os.Stdin)
+			if err != nil {
+				return nil, fmt.Errorf("read stdin: %w", err)
+			}
+
+			s.stdinReader = bufio.NewReaderSize(r, n)
+		}
+
+		b, err := s.stdinReader.Peek(n)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("sample stdin: %w", err)
+		}
+
+		return b, nil
+	}
+
+	if len(s.files) == 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(s.files[0])
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r, err := decompress(f)
+	if err != nil {
+		return nil, fmt.Errorf("sample %s: %w", s.files[0], err)
+	}
+
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	b := make([]byte, n)
+	m, err := io.ReadFull(r, b)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("sample %s: %w", s.files[0], err)
+	}
+
+	return b[:m], nil
+}
+
+func (s *Inputs) open(file string, follow bool) (*InputFile, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &InputFile{Name: file, closers: []io.Closer{f}}
+
+	if err := s.openFile(in, f, follow); err != nil {
+		_ = in.Close()
+		return nil, fmt.Errorf("read %s: %w", file, err)
+	}
+
+	return in, nil
+}
+
+func (s *Inputs) openFile(in *InputFile, f *os.File, follow bool) (err error) {
+	if in.ID, err = fileIdentity(f, in.Name); err != nil {
+		return err
+	}
+
+	if s.Resume != nil {
+		in.Offset = s.Resume(f, in.ID)
+	}
+
+	magic := make([]byte, 4)
+	n, err := f.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	r, compressed, err := newDecompressor(magic[:n], f)
+	if err != nil {
+		return err
+	}
+
+	if compressed {
+		if c, ok := r.(io.Closer); ok {
+			in.closers = append(in.closers, c)
+		}
+
+		// The compressed content can not be seeked, the bytes before the offset are decompressed and discarded.
+		if _, err := io.CopyN(io.Discard, r, in.Offset); err != nil {
+			return fmt.Errorf("skip %d bytes: %w", in.Offset, err)
+		}
+
+		if follow {
+			log.Printf("Reading %s, --follow is ignored for the compressed file", in.Name)
+		} else {
+			log.Printf("Reading %s", in.Name)
+		}
+
+		in.r = r
+
+		return nil
+	}
+
+	if in.Offset > in.ID.Size {
+		log.Printf("%s is smaller than the offset %d, read from the start", in.Name, in.Offset)
+		in.Offset = 0
+	}
+
+	if _, err := f.Seek(in.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	if !follow {
+		log.Printf("Reading %s", in.Name)
+		in.r = f
+
+		return nil
+	}
+
+	log.Printf("Following %s", in.Name)
+	in.follow = &followReader{ctx: s.ctx, file: in.Name, f: f, poll: s.options.Poll, offset: in.Offset}
+	in.r = in.follow
+
+	return nil
+}
+
+// fileIdentity returns the identity of the file, by its inode, size and the hash of the head.
+func fileIdentity(f *os.File, path string) (FileID, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return FileID{}, err
+	}
+
+	id := FileID{Path: path, Inode: fileInode(fi), Size: fi.Size(), HeadSize: headSize}
+	if id.Size < headSize {
+		id.HeadSize = int(id.Size)
+	}
+
+	id.HeadHash, err = headHash(f, id.HeadSize)
+
+	return id, err
+}
+
+// headHash returns the hex SHA-256 of the first n bytes of the file.
+func headHash(f *os.File, n int) (string, error) {
+	head := make([]byte, n)
+	if _, err := f.ReadAt(head, 0); err != nil && err != io.EOF {
+		return "", err
+	}
+
+	h := sha256.Sum256(head)
+
+	return hex.EncodeToString(h[:]), nil
+}
+
+// inputFiles returns the files matched by the glob pattern in the order.
+func inputFiles(pattern, order string) ([]string, error) {
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("glob %s: %w", pattern, err)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files matched by %s", pattern)
+	}
+
+	switch order {
+	case OrderName:
+		sort.Strings(files)
+	case OrderMtime:
+		mtimes := make(map[string]time.Time, len(files))
+		for _, f := range files {
+			fi, err := os.Stat(f)
+			if err != nil {
+				return nil, err
+			}
+
+			mtimes[f] = fi.ModTime()
+		}
+
+		sort.SliceStable(files, func(i, j int) bool { return mtimes[files[i]].Before(mtimes[files[j]]) })
+	default:
+		return nil, fmt.Errorf("unknown order %s, should be %s or %s", order, OrderName, OrderMtime)
+	}
+
+	return files, nil
+}
+
+// decompress returns the reader decompressing r if it is compressed by gzip, bzip2 or zstd, else the plain r.
+func decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	d, _, err := newDecompressor(magic, br)
+
+	return d, err
+}
+
+// newDecompressor returns the decompressor of r by the magic numbers of its head, or r itself if not compressed.
+func newDecompressor(magic []byte, r io.Reader) (_ io.Reader, compressed bool, _ error) {
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gr, err := gzip.NewReader(r)
+		return gr, true, err
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(r), true, nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, true, err
+		}
+
+		return d.IOReadCloser(), true, nil
+	default:
+		return r, false, nil
+	}
+}
+
+// followReader reads the growing file like tail -F, and returns io.EOF when the context canceled,
+// or when the file is read up after it is rotated or truncated, to be reopened as a new input file.
+type followReader struct {
+	ctx  context.Context
+	file string
+	poll time.Duration
+
+	f      *os.File
+	offset int64
+	// rotated is set when the file is replaced by a new one or truncated.
+	rotated bool
+}
+
+func (r *followReader) Read(p []byte) (int, error) {
+	for {
+		n, err := r.f.Read(p)
+		r.offset += int64(n)
+
+		if n > 0 || err != nil && err != io.EOF {
+			return n, err
+		}
+
+		// Read up the old file once more after the rotation detected, the lines written before it are not lost.
+		if r.rotated {
+			return 0, io.EOF
+		}
+
+		if r.rotated, err = r.detectRotation(); err != nil {
+			return 0, err
+		} else if r.rotated {
+			continue
+		}
+
+		select {
+		case <-r.ctx.Done():
+			return 0, io.EOF
+		case <-time.After(r.poll):
+		}
+	}
+}
+
+// detectRotation detects the file replaced by a new one, or truncated.
+func (r *followReader) detectRotation() (bool, error) {
+	fi, err := os.Stat(r.file)
+	if err != nil {
+		// maybe in the middle of the rotation, check again later.
+		return false, nil
+	}
+
+	cur, err := r.f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	if !os.SameFile(fi, cur) {
+		log.Printf("%s is rotated, reopen it after %d bytes read", r.file, r.offset)
+		return true, nil
+	}
+
+	if fi.Size() < r.offset {
+		log.Printf("%s is truncated from %d to %d bytes, reopen it", r.file, r.offset, fi.Size())
+		return true, nil
+	}
+
+	return false, nil
+}
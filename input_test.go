@@ -0,0 +1,294 @@
+package sqlite3perf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const inputLines = "line 1\nline 2\n"
+
+func TestInputsDecompress(t *testing.T) {
+	bz2, err := os.ReadFile("testdata/lines.log.bz2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		content func(t *testing.T) []byte
+	}{
+		{name: "plain", content: func(*testing.T) []byte { return []byte(inputLines) }},
+		{name: "gzip", content: func(t *testing.T) []byte {
+			var b bytes.Buffer
+
+			w := gzip.NewWriter(&b)
+			if _, err := w.Write([]byte(inputLines)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			return b.Bytes()
+		}},
+		{name: "bzip2", content: func(*testing.T) []byte { return bz2 }},
+		{name: "zstd", content: func(t *testing.T) []byte {
+			w, err := zstd.NewWriter(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer w.Close()
+
+			return w.EncodeAll([]byte(inputLines), nil)
+		}},
+		{name: "shorter than the magic", content: func(*testing.T) []byte { return []byte("a\n") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := tt.content(t)
+			want := inputLines
+			if tt.name == "shorter than the magic" {
+				want = string(content)
+			}
+
+			r, err := decompress(bytes.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := io.ReadAll(r); err != nil || string(got) != want {
+				t.Errorf("decompress() = %q, %v, want %q", got, err, want)
+			}
+
+			// The file is detected by the magic numbers read at, not by the file extension.
+			file := filepath.Join(t.TempDir(), "a.log")
+			writeFile(t, file, string(content))
+
+			inputs, err := OpenInputs(context.Background(), file, InputOptions{Order: OrderName})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			wantSample := want
+			if len(wantSample) > 4 {
+				wantSample = wantSample[:4]
+			}
+
+			if sample, err := inputs.Sample(4); err != nil || string(sample) != wantSample {
+				t.Errorf("Sample(4) = %q, %v, want %q", sample, err, wantSample)
+			}
+
+			in, err := inputs.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer in.Close()
+
+			if got, err := io.ReadAll(in); err != nil || string(got) != want {
+				t.Errorf("Next() read %q, %v, want %q", got, err, want)
+			}
+		})
+	}
+}
+
+func TestInputsSampleStdin(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		want string
+	}{
+		{name: "head", n: 4, want: "line"},
+		{name: "all before EOF", n: 100, want: inputLines},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, w, err := os.Pipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			go func() {
+				_, _ = w.Write([]byte(inputLines))
+				_ = w.Close()
+			}()
+
+			saved := os.Stdin
+			os.Stdin = r
+
+			defer func() { os.Stdin = saved }()
+
+			inputs, err := OpenInputs(context.Background(), "-", InputOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if sample, err := inputs.Sample(tt.n); err != nil || string(sample) != tt.want {
+				t.Errorf("Sample(%d) = %q, %v, want %q", tt.n, sample, err, tt.want)
+			}
+
+			// The sample is peeked, not consumed.
+			in, err := inputs.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := io.ReadAll(in); err != nil || string(got) != inputLines {
+				t.Errorf("Next() read %q, %v, want %q", got, err, inputLines)
+			}
+
+			if _, err := inputs.Next(); err != io.EOF {
+				t.Errorf("Next() after stdin error = %v, want EOF", err)
+			}
+		})
+	}
+}
+
+func TestInputFiles(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	// The names in the reversed order of the mtimes.
+	for i, name := range []string{"a.log", "b.log", "c.log"} {
+		file := filepath.Join(dir, name)
+		writeFile(t, file, inputLines)
+
+		mtime := now.Add(-time.Duration(i) * time.Hour)
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pattern, order string
+		want           []string
+		wantErr        bool
+	}{
+		{pattern: "*.log", order: OrderName, want: []string{"a.log", "b.log", "c.log"}},
+		{pattern: "*.log", order: OrderMtime, want: []string{"c.log", "b.log", "a.log"}},
+		{pattern: "[ab].log", order: OrderName, want: []string{"a.log", "b.log"}},
+		{pattern: "*.log", order: "size", wantErr: true},
+		{pattern: "*.txt", order: OrderName, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" by "+tt.order, func(t *testing.T) {
+			files, err := inputFiles(filepath.Join(dir, tt.pattern), tt.order)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("inputFiles() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var got []string
+			for _, f := range files {
+				got = append(got, filepath.Base(f))
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inputFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFollowReaderRotation(t *testing.T) {
+	tests := []struct {
+		name string
+		// change changes the file followed after its lines read.
+		change      func(t *testing.T, file string)
+		wantRotated bool
+		// want is read after the change, until EOF or the context canceled.
+		want string
+	}{
+		{
+			name:   "appended",
+			change: func(t *testing.T, file string) { appendFile(t, file, "line 3\n") },
+			want:   "line 3\n",
+		},
+		{
+			name: "rotated",
+			change: func(t *testing.T, file string) {
+				appendFile(t, file, "line 3\n")
+
+				if err := os.Rename(file, file+".1"); err != nil {
+					t.Fatal(err)
+				}
+
+				writeFile(t, file, "new 1\n")
+			},
+			wantRotated: true,
+			// The lines written before the rotation are read up.
+			want: "line 3\n",
+		},
+		{
+			name:        "truncated",
+			change:      func(t *testing.T, file string) { writeFile(t, file, "") },
+			wantRotated: true,
+		},
+		{
+			name: "removed",
+			change: func(t *testing.T, file string) {
+				if err := os.Remove(file); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "a.log")
+			writeFile(t, file, inputLines)
+
+			f, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+
+			r := &followReader{ctx: ctx, file: file, f: f, poll: 10 * time.Millisecond}
+
+			head := make([]byte, len(inputLines))
+			if _, err := io.ReadFull(r, head); err != nil || string(head) != inputLines {
+				t.Fatalf("Read() = %q, %v, want %q", head, err, inputLines)
+			}
+
+			tt.change(t, file)
+
+			// Read until EOF, by the rotation detected or by the context canceled.
+			got, err := io.ReadAll(r)
+			if err != nil || string(got) != tt.want || r.rotated != tt.wantRotated {
+				t.Errorf("Read() = %q, %v, rotated %v, want %q, rotated %v", got, err, r.rotated, tt.want, tt.wantRotated)
+			}
+		})
+	}
+}
+
+// appendFile appends the content to the file.
+func appendFile(t *testing.T, file, content string) {
+	t.Helper()
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
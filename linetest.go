@@ -0,0 +1,241 @@
+package sqlite3perf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// LineTestCmd is the struct representing the logline test sub-command.
+type LineTestCmd struct {
+	ParseCmd
+	// Records is the number of the records parsed, matched or failed.
+	Records int
+}
+
+// lineTestCommand returns the logline test sub-command.
+func lineTestCommand() *cobra.Command {
+	c := LineTestCmd{}
+	cmd := &cobra.Command{
+		Use:   "test",
+		Short: "test the pattern file by the input",
+		Long: `parse the first records of the input file by the pattern file or the built-in format,
+without touching the database, and print the fields of each record with their names, types and values,
+and the lines failed to match with the index of the pattern failed`,
+		Run: c.run,
+	}
+	c.initFlags(cmd.Flags())
+
+	return cmd
+}
+
+func (g *LineTestCmd) initFlags(f *pflag.FlagSet) {
+	g.initParserFlags(f)
+	f.IntVarP(&g.Records, "records", "n", 10, "number of the records parsed, matched or failed")
+}
+
+func (g *LineTestCmd) run(cmd *cobra.Command, args []string) {
+	if g.Records < 1 {
+		log.Fatalf("--records %d should be positive", g.Records)
+	}
+
+	parser, t, convs, err := g.recordParser(cmd.Flags())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rp, err := parser()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	inputs, err := OpenInputs(cmd.Context(), g.File, g.Input)
+	if err != nil {
+		log.Fatalf("open %s error: %v", g.File, err)
+	}
+
+	start, err := g.recordStart(inputs)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Record start: %s", start)
+
+	lt := &lineTester{recordAssembler: newRecordAssembler(rp, convs, len(t.Columns) == 0), t: t,
+		d: DriverDialect(driverName), color: isTerminal(os.Stdout), failures: make(map[int]int)}
+
+	for lt.records < g.Records && cmd.Context().Err() == nil {
+		in, err := inputs.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			log.Fatal(err)
+		}
+
+		err = lt.testFile(in, start, g.Records)
+		_ = in.Close()
+
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	lt.summary()
+}
+
+// lineTester parses the records one by one by the assembler of the pipeline, and prints them.
+type lineTester struct {
+	recordAssembler
+
+	t     Table
+	d     Dialect
+	color bool
+
+	records, matched int
+	// failures are the numbers of the lines failed by the index of the pattern.
+	failures map[int]int
+}
+
+// testFile parses the records of the input file until n records parsed.
+func (lt *lineTester) testFile(in *InputFile, start RecordStart, n int) error {
+	offset, next := in.Offset, in.Offset
+	split := start.Split()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		if advance > 0 {
+			offset, next = next, next+int64(advance)
+		}
+
+		return advance, token, err
+	})
+
+	for lt.records < n && scanner.Scan() {
+		lt.test(bytes.TrimSpace(scanner.Bytes()), in.Name, offset)
+	}
+
+	return scanner.Err()
+}
+
+// test parses the line of the file at offset by the pattern of the current index of the record.
+func (lt *lineTester) test(line []byte, file string, offset int64) {
+	pos := fmt.Sprintf("%s:%d", file, offset)
+	if len(lt.partial) > 0 {
+		pos = fmt.Sprintf("%s:%d", lt.partial[0].File, lt.partial[0].Offset)
+	}
+
+	matched, complete := lt.addLine(line, file, offset)
+	if !matched {
+		lt.fail(line, pos, fmt.Sprintf("%s:%d", file, offset))
+		return
+	}
+
+	if !complete {
+		return
+	}
+
+	lt.records++
+	lt.matched++
+	fmt.Printf("record %d at %s, %d lines matched\n", lt.records, pos, lt.rp.Lines())
+	lt.printFields()
+
+	lt.reset()
+}
+
+// fail prints the line at pos failed to match by the pattern of the current index,
+// with the lines before of the record at recordPos.
+func (lt *lineTester) fail(line []byte, recordPos, pos string) {
+	lt.records++
+	lt.failures[lt.idx]++
+
+	fmt.Println(lt.highlight(fmt.Sprintf("record %d at %s, FAILED by the pattern %d of %d lines",
+		lt.records, recordPos, lt.idx, lt.rp.Lines())))
+
+	for _, l := range lt.partial {
+		fmt.Printf("  matched by %d: %s\n", l.Pattern, l.Line)
+	}
+
+	fmt.Println(lt.highlight(fmt.Sprintf("  failed  by %d at %s: %s", lt.idx, pos, line)))
+	fmt.Println()
+
+	lt.reset()
+}
+
+// printFields prints the fields of the record in the order of the columns, and the ones not inserted after them.
+func (lt *lineTester) printFields() {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "  field\ttype\tvalue")
+
+	printed := make(map[string]bool)
+
+	for _, c := range lt.t.InsertColumns() {
+		printed[c.Name] = true
+		_, _ = fmt.Fprintf(w, "  %s\t%s\t%s\n", c.Name, c.typeName(lt.d), fieldValue(lt.values[c.Name]))
+	}
+
+	names := make([]string, 0, len(lt.values))
+	for name := range lt.values {
+		if !printed[name] {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		typeName := "(not inserted)"
+		if len(lt.t.Columns) == 0 { // the dynamic columns.
+			typeName = dynamicColumn(name, lt.values[name]).typeName(lt.d)
+		}
+
+		_, _ = fmt.Fprintf(w, "  %s\t%s\t%s\n", name, typeName, fieldValue(lt.values[name]))
+	}
+
+	_ = w.Flush()
+	fmt.Println()
+}
+
+// summary prints the numbers of the records matched and failed by the index of the pattern.
+func (lt *lineTester) summary() {
+	fmt.Printf("%d records parsed, %d matched, %d failed\n", lt.records, lt.matched, lt.records-lt.matched)
+
+	for idx := 0; idx < lt.rp.Lines(); idx++ {
+		if n := lt.failures[idx]; n > 0 {
+			fmt.Println(lt.highlight(fmt.Sprintf("%d lines failed by the pattern %d", n, idx)))
+		}
+	}
+}
+
+// highlight highlights the text in red on the terminal.
+func (lt *lineTester) highlight(s string) string {
+	if !lt.color {
+		return s
+	}
+
+	return "\033[31m" + s + "\033[0m"
+}
+
+func fieldValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
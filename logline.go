@@ -2,18 +2,16 @@ package sqlite3perf
 
 import (
 	"bufio"
-	"bytes"
-	"database/sql"
-	"errors"
+	"context"
 	"fmt"
 	"github.com/bingoohuang/gg/pkg/logline"
 	"github.com/bingoohuang/gg/pkg/ss"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
-	"io"
 	"log"
 	"os"
 	"regexp"
+	"runtime"
 	"strings"
 	"time"
 	"unicode"
@@ -25,6 +23,30 @@ type ParseCmd struct {
 	PatternFile  string
 	QuoteReplace string
 	LineStart    string
+	BatchSize    int
+	// TxSize is the number of the records committed in a transaction.
+	TxSize     int
+	LogSeconds int
+	// Workers is the number of the parser workers.
+	Workers int
+	// ChunkLines is the number of the lines dispatched to a parser worker at one time.
+	ChunkLines int
+
+	Input InputOptions
+	// Checkpoint saves the offsets of the committed records, to resume the imports where they stopped.
+	Checkpoint bool
+	// RejectFile is the JSON lines file to append the lines not parsed.
+	RejectFile string
+	// RejectTable inserts the lines not parsed into the <table>_rejects table.
+	RejectTable bool
+	// NewVersion creates the versioned table instead when the table has incompatible columns.
+	NewVersion bool
+	// Format is the built-in format parsed instead of the pattern file.
+	Format string
+	// StartRegex is the regular expression of the lines starting the records, instead of LineStart.
+	StartRegex string
+	// StartSample is the KiB of the head of the input sampled to detect the record start by --start auto.
+	StartSample int
 }
 
 // nolint:gochecknoinits
@@ -37,98 +59,199 @@ func init() {
 		Run:   c.run,
 	}
 	c.initFlags(cmd.Flags())
+	cmd.AddCommand(lineTestCommand())
 	rootCmd.AddCommand(cmd)
 }
 
-func (g *ParseCmd) initFlags(f *pflag.FlagSet) {
-	// Here you will define your flags and configuration settings.
-	f.StringVarP(&g.File, "file", "f", "", "file to parse")
+// initParserFlags defines the flags of the inputs and the parsing, shared with the logline test sub-command.
+func (g *ParseCmd) initParserFlags(f *pflag.FlagSet) {
+	f.StringVarP(&g.File, "file", "f", "", "file to parse, - for stdin, or glob pattern like 'logs/app.log*'")
 	f.StringVarP(&g.PatternFile, "pattern", "p", "", "pattern file ")
 	f.StringVarP(&g.QuoteReplace, "quote", "", "\"", "quote replacement")
-	f.StringVarP(&g.LineStart, "start", "", "2021/05/29 13:09:46", "line start")
+	f.StringVarP(&g.LineStart, "start", "", "2021/05/29 13:09:46",
+		"sample of the line start of the records, digits match any digits, or auto to detect it from the input")
+	f.StringVar(&g.StartRegex, "start-regex", "", "regular expression matched at the starts of the lines starting the records")
+	f.IntVar(&g.StartSample, "start-sample", 64, "KiB of the head of the input sampled by --start auto")
+	f.StringVar(&g.Format, "format", "",
+		"built-in format parsed instead of the pattern file, "+strings.Join(FormatNames(), "/"))
+	f.StringVar(&g.Input.Order, "order", OrderName, "order of the files matched by the glob pattern, name or mtime")
+}
+
+func (g *ParseCmd) initFlags(f *pflag.FlagSet) {
+	// Here you will define your flags and configuration settings.
+	g.initParserFlags(f)
+	f.IntVarP(&g.BatchSize, "batch", "b", 100, "number of records as a batch to insert at one time")
+	f.IntVar(&g.TxSize, "tx", 10000, "number of records committed in a transaction, 0 to commit at the end")
+	f.IntVarP(&g.LogSeconds, "interval", "i", 2, "interval seconds between progress messages")
+	f.IntVarP(&g.Workers, "workers", "w", runtime.NumCPU(), "number of parser workers")
+	f.IntVar(&g.ChunkLines, "chunk", 1000, "number of lines dispatched to a parser worker at one time")
+	f.BoolVar(&g.Input.Follow, "follow", false, "tail the (last) file across rotations and keep inserting")
+	f.DurationVar(&g.Input.Poll, "poll", time.Second,
+		"interval to poll the followed file, and the max delay to insert the streamed lines")
+	f.BoolVar(&g.Checkpoint, "checkpoint", true,
+		"save the offsets of the committed records to the logline_checkpoint table, and resume from them")
+	f.StringVar(&g.RejectFile, "reject-file", "", "JSON lines file to append the lines not parsed")
+	f.BoolVar(&g.RejectTable, "reject-table", false, "insert the lines not parsed into the <table>_rejects table")
+	f.BoolVar(&g.NewVersion, "new-version", false,
+		"use the versioned table <table>_v2, _v3... when the table has columns incompatible with the patterns")
 }
 
 func (g *ParseCmd) run(cmd *cobra.Command, args []string) {
 	log.Printf("Parse records by config %+v", g)
 
-	log.Print("Opening database")
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		log.Fatalf("Error while opening database '%s': %v", dbPath, err)
-	}
+	db := openDB(dbPath, 1)
 	defer db.Close()
 
-	pp, err := ParsePatterns(g.PatternFile, g.QuoteReplace)
+	if g.Workers < 1 || g.ChunkLines < 1 || g.Input.Poll <= 0 || g.LogSeconds < 1 {
+		log.Fatalf("--workers %d, --chunk %d, --poll %s and --interval %d should be positive",
+			g.Workers, g.ChunkLines, g.Input.Poll, g.LogSeconds)
+	}
+
+	parser, t, convs, err := g.recordParser(cmd.Flags())
 	if err != nil {
-		log.Fatalf("parse pattern error, %v", err)
+		log.Fatal(err)
+	}
+
+	// The table of the dynamic columns is created or altered when the columns added by the records.
+	if len(t.Columns) > 0 {
+		if t, err = EvolveTable(db, t, schema, g.NewVersion); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	createTable, insertTable, columns := g.createSqls(pp)
-	if _, err := db.Exec(createTable); err != nil {
-		// maybe already created, just print error and continue.
-		log.Printf("create table %s: %s", createTable, err)
+	// Records of the same key replace the previous ones, like the same log imported again.
+	conflict := ConflictPlain
+	if _, ok := t.KeyColumn(); ok {
+		conflict = ConflictReplace
 	}
 
-	ps, err := db.Prepare(insertTable)
+	w, err := NewBatchWriter(db, t, conflict, g.BatchSize, g.TxSize)
 	if err != nil {
-		log.Fatalf("prepare  %s error %s", insertTable, err)
+		log.Fatal(err)
 	}
 
-	f, err := os.Open(g.File)
+	inputs, err := OpenInputs(cmd.Context(), g.File, g.Input)
 	if err != nil {
 		log.Fatalf("open %s error: %v", g.File, err)
 	}
-	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
-	scanner.Split(NewScanLines(g.LineStart))
-	totalRows, rows := 0, 0
+	start, err := g.recordStart(inputs)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	start := time.Now()
-	ctx := cmd.Context()
+	log.Printf("Record start: %s", start)
 
-	idx := 0
-	values := make(map[string]interface{})
-	for scanner.Scan() && ctx.Err() == nil {
-		line := bytes.TrimSpace(scanner.Bytes())
-		m, ok := pp[idx].ParseBytes(line)
-		if !ok {
-			idx = 0
-			continue
+	p := &Pipeline{Parser: parser, Start: start, Workers: g.Workers, ChunkLines: g.ChunkLines,
+		Converters: convs, DynamicColumns: len(t.Columns) == 0}
+	if g.File == "-" || g.Input.Follow {
+		p.FlushInterval = g.Input.Poll
+	}
+
+	if p.Rejects, err = NewRejects(db, t.Name, g.RejectFile, g.RejectTable); err != nil {
+		log.Fatalf("open rejects error: %v", err)
+	}
+	defer p.Rejects.Close()
+
+	if g.Checkpoint {
+		if p.Checkpoints, err = LoadCheckpoints(db, t.Name); err != nil {
+			log.Fatalf("load checkpoints error: %v", err)
 		}
-		merge(m, values)
 
-		idx++
+		inputs.Resume = p.Checkpoints.Resume
+	}
 
-		if idx == len(pp) {
-			result := make([]interface{}, 0, columns)
-			for _, p := range pp {
-				for _, dot := range p.Dots {
-					if dot.Valid() {
-						result = append(result, values[dot.Name])
-					}
-				}
-			}
-			if _, err := ps.ExecContext(ctx, result...); err != nil {
-				log.Fatalf("exec error: %v", err)
-			}
-			rows++
-			totalRows++
-			if rows >= 1000 {
-				Printing("Rows %d generated, cost %s", totalRows, time.Since(start))
-				rows = 0
-			}
+	w.BeforeCommit = p.BeforeCommit
+
+	err = p.Run(cmd.Context(), inputs, w, time.Duration(g.LogSeconds)*time.Second)
 
-			values = make(map[string]interface{})
-			idx = 0
+	// Commit the records parsed so far even if failed or canceled, with a new context.
+	if cerr := w.Close(context.Background()); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		log.Fatalf("parse %s error: %v", g.File, err)
+	}
+
+	log.Printf("%d records committed into %s", w.Committed(), t.Name)
+}
+
+// recordParser returns the parser of the records, and the table of the columns of them,
+// by the built-in format of --format, or by the patterns and the converters of the pattern file.
+func (g *ParseCmd) recordParser(f *pflag.FlagSet) (func() (RecordParser, error), Table, Converters, error) {
+	switch {
+	case g.Format != "" && g.PatternFile != "":
+		return nil, Table{}, nil, fmt.Errorf("--format and --pattern are exclusive")
+	case g.Format != "":
+		format, err := LookupFormat(g.Format)
+		if err != nil {
+			return nil, Table{}, nil, err
 		}
+
+		if !f.Changed("start") {
+			g.LineStart = format.Start
+		}
+
+		// The parsers of the formats are safe for concurrent use.
+		parser := func() (RecordParser, error) { return format.Parser, nil }
+
+		return parser, Table{Name: table, Columns: format.Columns}, nil, nil
+	case g.PatternFile == "":
+		return nil, Table{}, nil, fmt.Errorf("--pattern or --format is required")
+	}
+
+	parser := func() (RecordParser, error) {
+		pp, err := ParsePatterns(g.PatternFile, g.QuoteReplace)
+		return patternParser(pp), err
+	}
+
+	pp, err := ParsePatterns(g.PatternFile, g.QuoteReplace)
+	if err != nil {
+		return nil, Table{}, nil, fmt.Errorf("parse pattern error, %w", err)
 	}
 
-	if err := scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
-		log.Fatalf("scanner error: %v", err)
+	convs, err := ParseConverters(g.PatternFile)
+	if err != nil {
+		return nil, Table{}, nil, fmt.Errorf("parse converters error, %w", err)
 	}
 
-	PrintEnd("Rows %d generated, cost %s\n", totalRows, time.Since(start))
+	t, err := patternTable(pp, convs)
+
+	return parser, t, convs, err
+}
+
+// recordStart returns the rule of the lines starting the records, by --start-regex, --start,
+// or detected from the sample of the inputs by --start auto.
+func (g *ParseCmd) recordStart(inputs *Inputs) (RecordStart, error) {
+	switch {
+	case g.StartRegex != "":
+		return NewRecordStart(g.StartRegex, "")
+	case g.LineStart != StartAuto:
+		return RecordStart{Sample: g.LineStart}, nil
+	case g.StartSample < 1:
+		return RecordStart{}, fmt.Errorf("--start-sample %d should be positive", g.StartSample)
+	}
+
+	sample, err := inputs.Sample(g.StartSample * 1024)
+	if err != nil {
+		return RecordStart{}, err
+	}
+
+	start, matched, lines := DetectRecordStart(sample)
+	log.Printf("Detected the record start from %d lines of %d bytes sampled, %d lines matched",
+		lines, len(sample), matched)
+
+	return start, nil
+}
+
+// patternParser parses the records by the patterns of the pattern file, a pattern for each line of a record.
+type patternParser []*logline.Pattern
+
+func (pp patternParser) Lines() int { return len(pp) }
+
+func (pp patternParser) Parse(idx int, line []byte) (map[string]interface{}, bool) {
+	return pp[idx].ParseBytes(line)
 }
 
 func merge(src, dst map[string]interface{}) {
@@ -180,34 +303,52 @@ func ParsePatterns(patternFile string, quoteReplace string) ([]*logline.Pattern,
 	return patterns, nil
 }
 
-func (g *ParseCmd) createSqls(pp []*logline.Pattern) (createTable, insertTable string, columns int) {
-	createTable = `CREATE TABLE ` + table + `(`
-	insertTable = `REPLACE INTO ` + table + `(`
+// patternTable returns the table of the columns by the valid dots of the patterns, the id column is the primary key.
+// The dots converted have the columns of their converters.
+func patternTable(pp []*logline.Pattern, convs Converters) (Table, error) {
+	t := Table{Name: table}
+	dots := make(map[string]bool)
 
 	for _, p := range pp {
 		for _, dot := range p.Dots {
 			if !dot.Valid() {
 				continue
 			}
+
+			dots[dot.Name] = true
+
+			if conv, ok := convs[dot.Name]; ok {
+				t.Columns = append(t.Columns, conv.Columns()...)
+				continue
+			}
+
+			c := Column{Name: dot.Name, Type: TypeText}
 			switch dot.Type {
 			case logline.Digits:
-				createTable += dot.Name + ` INTEGER`
+				c.Type = TypeBigInt
 			case logline.Float:
-				createTable += dot.Name + ` REAL`
-			default:
-				createTable += dot.Name + ` TEXT`
+				c.Type = TypeReal
 			}
+
 			if strings.EqualFold(dot.Name, "id") {
-				createTable += " PRIMARY KEY"
+				c.PrimaryKey = true
+				// text can not be a primary key in MySQL.
+				if c.Type == TypeText {
+					c.Type, c.Size = TypeVarchar, 255
+				}
 			}
-			createTable += ","
-			insertTable += dot.Name + `,`
-			columns++
+
+			t.Columns = append(t.Columns, c)
 		}
 	}
-	createTable = createTable[:len(createTable)-1] + `)`
-	insertTable = insertTable[:len(insertTable)-1] + `) VALUES (` + strings.Repeat(`,?`, columns)[1:] + `)`
-	return createTable, insertTable, columns
+
+	for name, conv := range convs {
+		if !dots[name] {
+			return t, fmt.Errorf("%s of the converter %s is not a dot of the patterns", name, conv)
+		}
+	}
+
+	return t, nil
 }
 
 func NewScanLines(start string) bufio.SplitFunc {
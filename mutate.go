@@ -0,0 +1,366 @@
+package sqlite3perf
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/gg/pkg/ss"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.uber.org/atomic"
+)
+
+// Modes of the update and delete workloads.
+const (
+	// MutateSingle updates or deletes a single record by a random key.
+	MutateSingle = "single"
+	// MutateRange updates or deletes the records in a random key range.
+	MutateRange = "range"
+)
+
+// Vacuum modes after the delete workload.
+const (
+	VacuumNone        = "none"
+	VacuumFull        = "full"
+	VacuumIncremental = "incremental"
+)
+
+// MutateCmd is the struct representing update and delete sub-commands.
+type MutateCmd struct {
+	Delete    bool
+	Mode      string
+	Num       int
+	RangeSize int
+	// Ratio mutates the ratio of the key ranges in a random order instead of Num random ones.
+	Ratio      float64
+	Prepared   bool
+	Vacuum     string
+	LogSeconds int
+	// IncrementalPages is the pages of PRAGMA incremental_vacuum(N) run every IncrementalEvery deletes.
+	IncrementalPages int
+	IncrementalEvery int
+
+	current     *atomic.Uint32
+	affected    int64
+	latencies   Latencies
+	incremental Latencies
+}
+
+// nolint:gochecknoinits
+func init() {
+	u := MutateCmd{}
+	updateCmd := &cobra.Command{
+		Use:   "update",
+		Short: "update records to benchmark against",
+		Long: `This command updates the records created with the "generate" command,
+either a single record by a random key, or the records in a random key range.`,
+		Run: u.run,
+	}
+
+	rootCmd.AddCommand(updateCmd)
+	u.initFlags(updateCmd.Flags())
+
+	d := MutateCmd{Delete: true}
+	deleteCmd := &cobra.Command{
+		Use:   "delete",
+		Short: "delete records to benchmark against",
+		Long: `This command deletes the records created with the "generate" command,
+either a single record by a random key, or the records in a random key range,
+optionally followed by a VACUUM or an incremental_vacuum.`,
+		Run: d.run,
+	}
+
+	rootCmd.AddCommand(deleteCmd)
+	d.initFlags(deleteCmd.Flags())
+}
+
+func (g *MutateCmd) initFlags(f *pflag.FlagSet) {
+	f.StringVarP(&g.Mode, "mode", "m", MutateSingle, "single: by a random key, range: by a random key range")
+	f.IntVarP(&g.Num, "num", "n", 1000, "number of statements to execute")
+	f.IntVar(&g.RangeSize, "range", 100, "number of keys in the range of range mode")
+	f.Float64Var(&g.Ratio, "ratio", 0, "ratio(0-1) of the key ranges to mutate in a random order, instead of --num")
+	f.BoolVarP(&g.Prepared, "prepared", "p", false, "use sql.DB Prepared statement for later executions.")
+	f.IntVarP(&g.LogSeconds, "interval", "i", 2, "interval seconds between progress messages")
+
+	if g.Delete {
+		f.StringVarP(&g.Vacuum, "vacuum", "v", VacuumNone, "vacuum after deletes(none/full/incremental)")
+		g.initIncrementalFlags(f)
+	}
+}
+
+func (g *MutateCmd) initIncrementalFlags(f *pflag.FlagSet) {
+	f.IntVar(&g.IncrementalPages, "incremental-vacuum", 0,
+		"pages N of PRAGMA incremental_vacuum(N) run periodically while deleting, 0 to disable")
+	f.IntVar(&g.IncrementalEvery, "incremental-every", 100, "deletes between the periodic incremental_vacuum")
+}
+
+func (g *MutateCmd) run(cmd *cobra.Command, args []string) {
+	log.Printf("Mutating records by config %+v", g)
+
+	if err := g.validate("ratio", "range"); err != nil {
+		log.Fatal(err)
+	}
+
+	t, ok := tables[table]
+	if !ok {
+		log.Fatalf("%s does not exist", table)
+	}
+
+	db := setupBench(false, 1)
+	defer db.Close()
+
+	logFileStats(db, "Before")
+	g.Run(db, t)
+
+	switch g.Vacuum {
+	case VacuumFull:
+		vacuumDB(db)
+	case VacuumIncremental:
+		incrementalVacuumDB(db, 0)
+		logFileStats(db, "After incremental vacuum")
+	}
+}
+
+// validate validates the ratio and the range size by the names of their flags, before touching the database.
+func (g *MutateCmd) validate(ratioFlag, rangeFlag string) error {
+	if !(g.Ratio >= 0 && g.Ratio <= 1) {
+		return fmt.Errorf("--%s %g should be in (0, 1], or 0 to disable", ratioFlag, g.Ratio)
+	}
+
+	if g.RangeSize < 1 {
+		return fmt.Errorf("--%s %d should be at least 1", rangeFlag, g.RangeSize)
+	}
+
+	return nil
+}
+
+// Run runs the update or delete workload on the table t.
+func (g *MutateCmd) Run(db *sql.DB, t Table) {
+	key, ok := t.KeyColumn()
+	if !ok {
+		log.Fatalf("table %s has no primary key", t.Name)
+	}
+
+	var min, max sql.NullInt64
+	if err := db.QueryRow("SELECT MIN("+key.Name+"), MAX("+key.Name+") FROM "+t.Name).
+		Scan(&min, &max); err != nil {
+		log.Fatalf("query key range of %s error: %v", t.Name, err)
+	}
+
+	if !min.Valid {
+		log.Fatalf("table %s has no records", t.Name)
+	}
+
+	rangeSize := int64(1)
+	if g.Mode == MutateRange {
+		rangeSize = int64(g.RangeSize)
+	}
+
+	nextFrom := randomFrom(min.Int64, max.Int64, rangeSize)
+	if g.Ratio > 0 {
+		nextFrom, g.Num = ratioFrom(min.Int64, max.Int64, rangeSize, g.Ratio)
+	}
+
+	if g.Num <= 0 {
+		return
+	}
+
+	g.current = atomic.NewUint32(0)
+	done := make(chan bool)
+	start := time.Now()
+
+	go g.mutates(db, t, key, nextFrom, done)
+	progressLogging(start, done, g.Num, g.current, g.LogSeconds, ss.If(g.Delete, "deleted", "updated"))
+
+	log.Printf("%d rows affected, statement latency %s", g.affected, g.latencies)
+
+	if len(g.incremental) > 0 {
+		log.Printf("%d times of incremental_vacuum(%d), latency %s",
+			len(g.incremental), g.IncrementalPages, g.incremental)
+	}
+
+	logFileStats(db, "After "+ss.If(g.Delete, "deletes", "updates"))
+}
+
+// randomFrom returns the random start keys of the ranges.
+// nolint:gosec
+func randomFrom(min, max, rangeSize int64) func(i int) int64 {
+	span := max - min + 1
+
+	return func(int) int64 {
+		if span > rangeSize {
+			return min + rand.Int63n(span-rangeSize+1)
+		}
+
+		return min
+	}
+}
+
+// ratioFrom returns the start keys of the ratio of all the ranges in a random order, and the number of them.
+func ratioFrom(min, max, rangeSize int64, ratio float64) (func(i int) int64, int) {
+	ranges := int((max-min)/rangeSize + 1)
+	perm := rand.Perm(ranges) // nolint:gosec
+
+	return func(i int) int64 { return min + int64(perm[i])*rangeSize }, int(float64(ranges) * ratio)
+}
+
+func (g *MutateCmd) mutates(db *sql.DB, t Table, key Column, nextFrom func(i int) int64, done chan bool) {
+	query, setColumns := g.createSQL(t, key)
+	execFn := func(args ...interface{}) (sql.Result, error) { return db.Exec(query, args...) }
+
+	if g.Prepared {
+		ps, err := db.Prepare(query)
+		if err != nil {
+			log.Fatalf("prepare query %s error %s", query, err)
+		}
+
+		defer ps.Close()
+
+		execFn = ps.Exec
+	}
+
+	g.latencies = make(Latencies, 0, g.Num)
+
+	log.Print("Starting ", ss.If(g.Delete, "deletes", "updates"))
+
+	args := make([]interface{}, 0, len(setColumns)+2)
+
+	for i := int(g.current.Load()); i < g.Num; i = int(g.current.Add(1)) {
+		from := nextFrom(i)
+
+		args = args[:0]
+		if !g.Delete {
+			args = append(args, setValues(t, setColumns, int(from))...)
+		}
+
+		args = append(args, from)
+		if g.Mode == MutateRange {
+			args = append(args, from+int64(g.RangeSize)-1)
+		}
+
+		start := time.Now()
+		r, err := execFn(args...)
+		if err != nil {
+			log.Fatalf("%s failed: %s", query, err)
+		}
+
+		g.latencies = append(g.latencies, time.Since(start))
+
+		if n, err := r.RowsAffected(); err == nil {
+			g.affected += n
+		}
+
+		if g.Delete && g.IncrementalPages > 0 && g.IncrementalEvery > 0 && (i+1)%g.IncrementalEvery == 0 {
+			start := time.Now()
+			incrementalVacuum(db, g.IncrementalPages)
+			g.incremental = append(g.incremental, time.Since(start))
+		}
+	}
+
+	done <- true
+}
+
+// createSQL creates the UPDATE or DELETE statement, and returns the updated columns.
+func (g *MutateCmd) createSQL(t Table, key Column) (query string, setColumns []int) {
+	where := " WHERE " + key.Name + "=?"
+	switch g.Mode {
+	case MutateSingle:
+	case MutateRange:
+		where = " WHERE " + key.Name + " BETWEEN ? AND ?"
+	default:
+		log.Fatalf("unknown mode %s", g.Mode)
+	}
+
+	d := DriverDialect(driverName)
+	if g.Delete {
+		return d.Rebind("DELETE FROM " + t.Name + where), nil
+	}
+
+	var sets []string
+	for i, c := range t.InsertColumns() {
+		if !c.PrimaryKey {
+			setColumns = append(setColumns, i)
+			sets = append(sets, c.Name+"=?")
+		}
+	}
+
+	return d.Rebind("UPDATE " + t.Name + " SET " + strings.Join(sets, ", ") + where), setColumns
+}
+
+// setValues generates the new values of the updated columns.
+func setValues(t Table, setColumns []int, key int) []interface{} {
+	values := t.Generator(key)
+	result := make([]interface{}, len(setColumns))
+	for i, c := range setColumns {
+		result[i] = values[c]
+	}
+
+	return result
+}
+
+// Latencies is the latencies of executions.
+type Latencies []time.Duration
+
+func (l Latencies) String() string {
+	if len(l) == 0 {
+		return "n/a"
+	}
+
+	sorted := make(Latencies, len(l))
+	copy(sorted, l)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var total time.Duration
+	for _, d := range sorted {
+		total += d
+	}
+
+	percentile := func(p float64) time.Duration { return sorted[int(float64(len(sorted)-1)*p)] }
+
+	return fmt.Sprintf("avg %s, p50 %s, p99 %s, max %s",
+		total/time.Duration(len(sorted)), percentile(0.5), percentile(0.99), sorted[len(sorted)-1])
+}
+
+func incrementalVacuumDB(db *sql.DB, pages int) {
+	var autoVacuum int
+	if err := db.QueryRow("PRAGMA auto_vacuum").Scan(&autoVacuum); err == nil && autoVacuum != 2 {
+		log.Printf("PRAGMA auto_vacuum=%d, incremental_vacuum takes effect only when auto_vacuum=INCREMENTAL(2)",
+			autoVacuum)
+	}
+
+	start := time.Now()
+	freed := incrementalVacuum(db, pages)
+	log.Printf("PRAGMA incremental_vacuum(%d) freed %d pages, took %s", pages, freed, time.Since(start))
+}
+
+// incrementalVacuum frees up to pages pages from the freelist, all of them if pages is 0,
+// and returns the number of the pages freed.
+func incrementalVacuum(db *sql.DB, pages int) (freed int) {
+	query := "PRAGMA incremental_vacuum"
+	if pages > 0 {
+		query = fmt.Sprintf("PRAGMA incremental_vacuum(%d)", pages)
+	}
+
+	// incremental_vacuum frees a page per step of the result, so all the rows have to be consumed.
+	rows, err := db.Query(query)
+	if err != nil {
+		log.Printf("%s caused an error: %s", query, err)
+		return 0
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		freed++
+	}
+
+	if err := rows.Err(); err != nil {
+		log.Printf("%s caused an error: %s", query, err)
+	}
+
+	return freed
+}
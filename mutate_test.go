@@ -0,0 +1,160 @@
+package sqlite3perf
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMutateCmdValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		ratio     float64
+		rangeSize int
+		wantErr   bool
+	}{
+		{name: "disabled", ratio: 0, rangeSize: 1},
+		{name: "part", ratio: 0.01, rangeSize: 100},
+		{name: "all", ratio: 1, rangeSize: 1},
+		{name: "ratio greater than 1", ratio: 1.5, rangeSize: 1, wantErr: true},
+		{name: "negative ratio", ratio: -0.1, rangeSize: 1, wantErr: true},
+		{name: "NaN ratio", ratio: math.NaN(), rangeSize: 1, wantErr: true},
+		{name: "zero range", ratio: 0.1, rangeSize: 0, wantErr: true},
+		{name: "negative range", ratio: 0.1, rangeSize: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &MutateCmd{Ratio: tt.ratio, RangeSize: tt.rangeSize}
+			if err := g.validate("ratio", "range"); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRatioFrom(t *testing.T) {
+	tests := []struct {
+		name      string
+		min, max  int64
+		rangeSize int64
+		ratio     float64
+		wantN     int
+	}{
+		{name: "half of the ranges", min: 1, max: 100, rangeSize: 10, ratio: 0.5, wantN: 5},
+		{name: "all the ranges", min: 1, max: 100, rangeSize: 10, ratio: 1, wantN: 10},
+		{name: "last range partial", min: 1, max: 95, rangeSize: 10, ratio: 1, wantN: 10},
+		{name: "all the keys", min: 11, max: 30, rangeSize: 1, ratio: 1, wantN: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from, n := ratioFrom(tt.min, tt.max, tt.rangeSize, tt.ratio)
+			if n != tt.wantN {
+				t.Fatalf("ratioFrom() n = %d, want %d", n, tt.wantN)
+			}
+
+			// The ranges are distinct, aligned to min, and within the keys.
+			seen := make(map[int64]bool, n)
+			for i := 0; i < n; i++ {
+				k := from(i)
+				if k < tt.min || k > tt.max || (k-tt.min)%tt.rangeSize != 0 || seen[k] {
+					t.Errorf("from(%d) = %d, seen %v", i, k, seen[k])
+				}
+
+				seen[k] = true
+			}
+		})
+	}
+}
+
+func TestRandomFrom(t *testing.T) {
+	tests := []struct {
+		name      string
+		min, max  int64
+		rangeSize int64
+		wantMax   int64
+	}{
+		{name: "single keys", min: 1, max: 10, rangeSize: 1, wantMax: 10},
+		{name: "ranges within the keys", min: 1, max: 10, rangeSize: 4, wantMax: 7},
+		{name: "range larger than the keys", min: 5, max: 10, rangeSize: 100, wantMax: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			from := randomFrom(tt.min, tt.max, tt.rangeSize)
+			for i := 0; i < 1000; i++ {
+				if k := from(i); k < tt.min || k > tt.wantMax {
+					t.Fatalf("from(%d) = %d, want in [%d, %d]", i, k, tt.min, tt.wantMax)
+				}
+			}
+		})
+	}
+}
+
+func TestMutateCmdRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		g            MutateCmd
+		wantAffected int64
+		// wantKeys is the number of the keys left, wantUpdated of them updated.
+		wantKeys, wantUpdated int
+	}{
+		{name: "delete all the ranges", g: MutateCmd{Delete: true, Mode: MutateRange, RangeSize: 10, Ratio: 1},
+			wantAffected: 100, wantKeys: 0},
+		{name: "delete half of the ranges", g: MutateCmd{Delete: true, Mode: MutateRange, RangeSize: 10, Ratio: 0.5},
+			wantAffected: 50, wantKeys: 50},
+		{name: "delete a tenth of the keys", g: MutateCmd{Delete: true, Mode: MutateSingle, RangeSize: 10, Ratio: 0.1},
+			wantAffected: 10, wantKeys: 90},
+		{name: "update all the ranges", g: MutateCmd{Mode: MutateRange, RangeSize: 7, Ratio: 1},
+			wantAffected: 100, wantKeys: 100, wantUpdated: 100},
+		{name: "update random keys", g: MutateCmd{Mode: MutateSingle, Num: 20, RangeSize: 1},
+			wantAffected: 20, wantKeys: 100},
+		{name: "update random ranges", g: MutateCmd{Mode: MutateRange, Num: 5, RangeSize: 10, Prepared: true},
+			wantAffected: 50, wantKeys: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := openTestDB(t, "sqlite3")
+			bench := tables["bench"]
+
+			createSQL, err := bench.CreateSQL(SQLite, SchemaDefault)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := db.Exec(createSQL); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := db.Exec(`WITH RECURSIVE k(id) AS (SELECT 1 UNION ALL SELECT id + 1 FROM k WHERE id < 100)
+INSERT INTO bench SELECT id, 'x', 'x' FROM k`); err != nil {
+				t.Fatal(err)
+			}
+
+			g := tt.g
+			g.LogSeconds = 1
+			g.Run(db, bench)
+
+			if g.affected != tt.wantAffected {
+				t.Errorf("affected = %d, want %d", g.affected, tt.wantAffected)
+			}
+
+			var keys, updated int
+			if err := db.QueryRow("SELECT COUNT(*), COUNT(NULLIF(rand, 'x')) FROM bench").Scan(&keys, &updated); err != nil {
+				t.Fatal(err)
+			}
+
+			if keys != tt.wantKeys {
+				t.Errorf("keys = %d, want %d", keys, tt.wantKeys)
+			}
+
+			// The random keys may repeat, all updated only by the ratio.
+			if tt.wantUpdated > 0 && updated != tt.wantUpdated {
+				t.Errorf("updated = %d, want %d", updated, tt.wantUpdated)
+			} else if !g.Delete && updated == 0 {
+				t.Error("updated none")
+			}
+		})
+	}
+}
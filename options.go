@@ -0,0 +1,204 @@
+package sqlite3perf
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// DBOptions are the SQLite options applied to the database by the tool itself, independent of the DSN.
+type DBOptions struct {
+	// PageSize is the PRAGMA page_size, only takes effect when the database is created or vacuumed.
+	PageSize int
+	// CacheSize is the PRAGMA cache_size, pages if positive or KiB if negative.
+	CacheSize int
+	// MmapSize is the PRAGMA mmap_size in bytes.
+	MmapSize int64
+	// TempStore is the PRAGMA temp_store, DEFAULT/FILE/MEMORY.
+	TempStore string
+	// JournalMode is the PRAGMA journal_mode, DELETE/TRUNCATE/PERSIST/MEMORY/WAL/OFF.
+	JournalMode string
+	// Synchronous is the PRAGMA synchronous, OFF/NORMAL/FULL/EXTRA.
+	Synchronous string
+	// BusyTimeout is the PRAGMA busy_timeout, negative for the default of the driver.
+	BusyTimeout time.Duration
+	// ForeignKeys is the PRAGMA foreign_keys, on/off.
+	ForeignKeys string
+	// LockingMode is the PRAGMA locking_mode, NORMAL/EXCLUSIVE.
+	LockingMode string
+}
+
+// nolint:gochecknoglobals
+var dbOptions DBOptions
+
+func (o *DBOptions) initFlags(p *pflag.FlagSet) {
+	p.IntVar(&o.PageSize, "page-size", 0, "PRAGMA page_size set when the table is (re-)created, 0 for the default")
+	p.IntVar(&o.CacheSize, "cache-size", 0, "PRAGMA cache_size, pages if positive or KiB if negative, 0 for the default")
+	p.Int64Var(&o.MmapSize, "mmap-size", -1, "PRAGMA mmap_size in bytes, -1 for the default")
+	p.StringVar(&o.TempStore, "temp-store", "", "PRAGMA temp_store(DEFAULT/FILE/MEMORY), empty for the default")
+	p.StringVar(&o.JournalMode, "journal-mode", "",
+		"PRAGMA journal_mode(DELETE/TRUNCATE/PERSIST/MEMORY/WAL/OFF), empty for the DSN or the default")
+	p.StringVar(&o.Synchronous, "synchronous", "",
+		"PRAGMA synchronous(OFF/NORMAL/FULL/EXTRA), empty for the DSN or the default")
+	p.DurationVar(&o.BusyTimeout, "busy-timeout", -1, "PRAGMA busy_timeout, negative for the DSN or the default")
+	p.StringVar(&o.ForeignKeys, "foreign-keys", "", "PRAGMA foreign_keys(on/off), empty for the DSN or the default")
+	p.StringVar(&o.LockingMode, "locking-mode", "",
+		"PRAGMA locking_mode(NORMAL/EXCLUSIVE), empty for the DSN or the default")
+}
+
+// CreatePragmas returns the PRAGMAs which only take effect when set before the database file is created.
+func (o DBOptions) CreatePragmas() []string {
+	if o.PageSize > 0 {
+		return []string{fmt.Sprintf("page_size=%d", o.PageSize)}
+	}
+
+	return nil
+}
+
+// ConnPragmas returns the PRAGMAs which are set per connection.
+func (o DBOptions) ConnPragmas() []string {
+	var pragmas []string
+	if o.JournalMode != "" {
+		pragmas = append(pragmas, "journal_mode="+strings.ToUpper(o.JournalMode))
+	}
+
+	if o.Synchronous != "" {
+		pragmas = append(pragmas, "synchronous="+strings.ToUpper(o.Synchronous))
+	}
+
+	if o.BusyTimeout >= 0 {
+		pragmas = append(pragmas, fmt.Sprintf("busy_timeout=%d", o.BusyTimeout.Milliseconds()))
+	}
+
+	if o.ForeignKeys != "" {
+		pragmas = append(pragmas, "foreign_keys="+strings.ToLower(o.ForeignKeys))
+	}
+
+	if o.LockingMode != "" {
+		pragmas = append(pragmas, "locking_mode="+strings.ToUpper(o.LockingMode))
+	}
+
+	if o.CacheSize != 0 {
+		pragmas = append(pragmas, fmt.Sprintf("cache_size=%d", o.CacheSize))
+	}
+
+	if o.MmapSize >= 0 {
+		pragmas = append(pragmas, fmt.Sprintf("mmap_size=%d", o.MmapSize))
+	}
+
+	if o.TempStore != "" {
+		pragmas = append(pragmas, "temp_store="+strings.ToUpper(o.TempStore))
+	}
+
+	return pragmas
+}
+
+func (o DBOptions) String() string {
+	return strings.Join(append(o.CreatePragmas(), o.ConnPragmas()...), " ")
+}
+
+// mattnParams are the DSN parameters of github.com/mattn/go-sqlite3 for the PRAGMAs,
+// the first one of the keys is the canonical one, and the later alias wins when both present.
+// nolint:gochecknoglobals
+var mattnParams = []struct {
+	pragma string
+	keys   []string
+}{
+	{pragma: "auto_vacuum", keys: []string{"_auto_vacuum", "_vacuum"}},
+	{pragma: "busy_timeout", keys: []string{"_busy_timeout", "_timeout"}},
+	{pragma: "case_sensitive_like", keys: []string{"_case_sensitive_like", "_cslike"}},
+	{pragma: "defer_foreign_keys", keys: []string{"_defer_foreign_keys", "_defer_fk"}},
+	{pragma: "foreign_keys", keys: []string{"_foreign_keys", "_fk"}},
+	{pragma: "ignore_check_constraints", keys: []string{"_ignore_check_constraints"}},
+	{pragma: "journal_mode", keys: []string{"_journal_mode", "_journal"}},
+	{pragma: "locking_mode", keys: []string{"_locking_mode", "_locking"}},
+	{pragma: "query_only", keys: []string{"_query_only"}},
+	{pragma: "recursive_triggers", keys: []string{"_recursive_triggers", "_rt"}},
+	{pragma: "secure_delete", keys: []string{"_secure_delete"}},
+	{pragma: "synchronous", keys: []string{"_synchronous", "_sync"}},
+	{pragma: "writable_schema", keys: []string{"_writable_schema"}},
+}
+
+// DSN translates the PRAGMAs of the mattn/go-sqlite3 parameters in the dsn and the options (which win)
+// into the DSN form of the driver, and returns the PRAGMAs to verify after open,
+// and the ones that the driver does not support in the DSN, which have to be set after open.
+func (o DBOptions) DSN(driver, dsn string) (translated string, pragmas, afterOpen []string, err error) {
+	if d := DriverDialect(driver); d != SQLite {
+		if p := o.ConnPragmas(); len(p) > 0 {
+			return "", nil, nil, fmt.Errorf("PRAGMA %v are only supported by %s, not %s", p, SQLite, d)
+		}
+
+		return dsn, nil, nil, nil
+	}
+
+	file, query := dsn, ""
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		file, query = dsn[:i], dsn[i+1:]
+	}
+
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("parse DSN %s: %w", dsn, err)
+	}
+
+	values := make(map[string]string)
+	var names []string
+
+	set := func(name, value string) {
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = value
+	}
+
+	for _, p := range mattnParams {
+		for _, k := range p.keys {
+			if v := q.Get(k); v != "" {
+				set(p.pragma, v)
+			}
+			q.Del(k)
+		}
+	}
+
+	for _, p := range o.ConnPragmas() {
+		set(splitPragma(p))
+	}
+
+	for _, name := range names {
+		if _, err := ParsePragma(name+"="+values[name], false); err != nil {
+			return "", nil, nil, err
+		}
+
+		pragmas = append(pragmas, name+"="+values[name])
+
+		switch driver {
+		case "sqlite": // modernc.org/sqlite runs each _pragma=name(value) on every new connection.
+			q.Add("_pragma", name+"("+values[name]+")")
+		default:
+			if k := mattnParamKey(name); k != "" {
+				q.Set(k, values[name])
+			} else {
+				afterOpen = append(afterOpen, name+"="+values[name])
+			}
+		}
+	}
+
+	if len(q) == 0 {
+		return file, pragmas, afterOpen, nil
+	}
+
+	return file + "?" + q.Encode(), pragmas, afterOpen, nil
+}
+
+func mattnParamKey(pragma string) string {
+	for _, p := range mattnParams {
+		if p.pragma == pragma {
+			return p.keys[0]
+		}
+	}
+
+	return ""
+}
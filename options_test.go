@@ -0,0 +1,157 @@
+package sqlite3perf
+
+import (
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDBOptionsDSN(t *testing.T) {
+	none := DBOptions{MmapSize: -1, BusyTimeout: -1}
+
+	withJournal := none
+	withJournal.JournalMode = "delete"
+
+	withCache := none
+	withCache.CacheSize = -64000
+
+	withTimeout := none
+	withTimeout.BusyTimeout = 3 * time.Second
+
+	tests := []struct {
+		name       string
+		options    DBOptions
+		driver     string
+		dsn        string
+		translated string
+		pragmas    []string
+		afterOpen  []string
+		wantErr    bool
+	}{
+		{
+			name: "mattn as is", options: none, driver: "sqlite3",
+			dsn:        "a.db",
+			translated: "a.db",
+		},
+		{
+			name: "mattn aliases canonical", options: none, driver: "sqlite3",
+			dsn:        "a.db?_journal=wal&_sync=0",
+			translated: "a.db?_journal_mode=wal&_synchronous=0",
+			pragmas:    []string{"journal_mode=wal", "synchronous=0"},
+		},
+		{
+			name: "later alias wins", options: none, driver: "sqlite3",
+			dsn:        "a.db?_journal_mode=delete&_journal=wal",
+			translated: "a.db?_journal_mode=wal",
+			pragmas:    []string{"journal_mode=wal"},
+		},
+		{
+			name: "options win over dsn", options: withJournal, driver: "sqlite3",
+			dsn:        "a.db?_journal=wal",
+			translated: "a.db?_journal_mode=DELETE",
+			pragmas:    []string{"journal_mode=DELETE"},
+		},
+		{
+			name: "mattn pragma without param after open", options: withCache, driver: "sqlite3",
+			dsn:        "a.db?cache=shared",
+			translated: "a.db?cache=shared",
+			pragmas:    []string{"cache_size=-64000"},
+			afterOpen:  []string{"cache_size=-64000"},
+		},
+		{
+			name: "modernc pragmas", options: withTimeout, driver: "sqlite",
+			dsn: "file:a.db?_journal=wal&_fk=1",
+			translated: "file:a.db?_pragma=foreign_keys%281%29&_pragma=journal_mode%28wal%29" +
+				"&_pragma=busy_timeout%283000%29",
+			pragmas: []string{"foreign_keys=1", "journal_mode=wal", "busy_timeout=3000"},
+		},
+		{
+			name: "invalid enum", options: none, driver: "sqlite3",
+			dsn:     "a.db?_journal=bogus",
+			wantErr: true,
+		},
+		{
+			name: "bad query", options: none, driver: "sqlite3",
+			dsn:     "a.db?%zz",
+			wantErr: true,
+		},
+		{
+			name: "mysql as is", options: none, driver: "mysql",
+			dsn:        "root:pass@tcp(127.0.0.1:3306)/db?_journal=wal",
+			translated: "root:pass@tcp(127.0.0.1:3306)/db?_journal=wal",
+		},
+		{
+			name: "pragma options refused by mysql", options: withJournal, driver: "mysql",
+			dsn:     "root:pass@tcp(127.0.0.1:3306)/db",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			translated, pragmas, afterOpen, err := tt.options.DSN(tt.driver, tt.dsn)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DSN() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if translated != tt.translated {
+				t.Errorf("DSN() translated = %s, want %s", translated, tt.translated)
+			}
+
+			if !reflect.DeepEqual(pragmas, tt.pragmas) {
+				t.Errorf("DSN() pragmas = %v, want %v", pragmas, tt.pragmas)
+			}
+
+			if !reflect.DeepEqual(afterOpen, tt.afterOpen) {
+				t.Errorf("DSN() afterOpen = %v, want %v", afterOpen, tt.afterOpen)
+			}
+		})
+	}
+}
+
+func TestSetupBenchPageSize(t *testing.T) {
+	savedPath, savedOptions, savedTable := dbPath, dbOptions, table
+	t.Cleanup(func() { dbPath, dbOptions, table = savedPath, savedOptions, savedTable })
+
+	tests := []struct {
+		name        string
+		query       string
+		existing    bool
+		pageSize    int
+		journalMode string
+	}{
+		{name: "new file in WAL", query: "?_journal=wal", pageSize: 8192, journalMode: "wal"},
+		{name: "existing file in WAL", query: "?_journal=wal", existing: true, pageSize: 16384, journalMode: "wal"},
+		{name: "existing file in DELETE", existing: true, pageSize: 1024, journalMode: "delete"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbPath = filepath.Join(t.TempDir(), "a.db") + tt.query
+			dbOptions = DBOptions{MmapSize: -1, BusyTimeout: -1}
+			table = "bench"
+
+			if tt.existing {
+				setupBench(true, 1).Close()
+			}
+
+			dbOptions.PageSize = tt.pageSize
+			db := setupBench(true, 1)
+			defer db.Close()
+
+			if got, err := QueryPragmaValue(db, "page_size"); err != nil || got != strconv.Itoa(tt.pageSize) {
+				t.Errorf("page_size = %s, %v, want %d", got, err, tt.pageSize)
+			}
+
+			if got, err := QueryPragmaValue(db, "journal_mode"); err != nil || got != tt.journalMode {
+				t.Errorf("journal_mode = %s, %v, want %s", got, err, tt.journalMode)
+			}
+		})
+	}
+}
@@ -0,0 +1,669 @@
+package sqlite3perf
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+// Pipeline parses the records of the lines by the reader -> N parser workers -> single writer stages,
+// connected by bounded channels.
+//
+// A record may span parser.Lines() lines, each line parsed by its position in the record,
+// which depends on the lines before. The workers speculate the position from 0 at the start of each chunk,
+// and the writer reassembles the chunks in order, parsing again only the lines speculated wrong,
+// which happens only at the start of a chunk splitting a multi-lines record.
+type Pipeline struct {
+	// Parser returns the parser for a parser worker, a copy for each worker,
+	// because the patterns are not documented to be safe for concurrent use.
+	Parser func() (RecordParser, error)
+	// Start is the rule of the lines starting the multi-lines records.
+	Start      RecordStart
+	Workers    int
+	ChunkLines int
+	// FlushInterval is the max delay of the lines in a partial chunk, and the interval to commit the records,
+	// for the streaming inputs, 0 to wait for the full chunks and batches.
+	FlushInterval time.Duration
+	// Checkpoints marks the offsets of the records written, nil to disable.
+	Checkpoints *Checkpoints
+	// Rejects counts and writes the lines not parsed.
+	Rejects *Rejects
+	// Converters converts the values of the dots of the records, nil for none.
+	Converters Converters
+	// DynamicColumns adds the columns of the keys of the records not in the table yet.
+	DynamicColumns bool
+
+	read, parse, write stageStats
+	// aborted is closed when the writer failed, to stop the reader and the workers blocked on sending to it.
+	aborted chan struct{}
+}
+
+// errAborted is returned by the reader stopped by the writer failed.
+var errAborted = errors.New("pipeline aborted by the writer failed")
+
+// BeforeCommit saves the rejected lines and then the checkpoints in the transaction, as the BatchWriter.BeforeCommit,
+// so that the checkpoints never pass the rejected lines not committed.
+func (p *Pipeline) BeforeCommit(tx *sql.Tx) error {
+	if p.Rejects != nil {
+		if err := p.Rejects.Save(tx); err != nil {
+			return err
+		}
+	}
+
+	if p.Checkpoints == nil {
+		return nil
+	}
+
+	return p.Checkpoints.Save(tx)
+}
+
+// stageStats is the statistics of a stage of the pipeline.
+type stageStats struct {
+	name  string
+	unit  string
+	count atomic.Int64
+	// busy is the time spent on the work, excluding the waiting on the channels, summed over the workers.
+	busy atomic.Duration
+}
+
+// rate returns the count per second of the stage on its own, with its busy time spread over the parallel workers.
+func (s *stageStats) rate(parallel int) float64 {
+	busy := s.busy.Load() / time.Duration(parallel)
+	if busy <= 0 {
+		return 0
+	}
+
+	return float64(s.count.Load()) / busy.Seconds()
+}
+
+// lineChunk is a chunk of the lines in the order of the reader.
+type lineChunk struct {
+	seq    int
+	lines  [][]byte
+	pos    []linePos
+	parsed []parsedLine
+}
+
+// linePos is the position of a line in the input file.
+type linePos struct {
+	in         *InputFile
+	start, end int64
+}
+
+// scannedLine is a line scanned from the input file.
+type scannedLine struct {
+	line []byte
+	pos  linePos
+}
+
+// parsedLine is the line parsed by the pattern of the speculated index.
+type parsedLine struct {
+	idx    int
+	values map[string]interface{}
+	ok     bool
+}
+
+// Run reads the lines of the inputs, parses the records and adds them to w in order, until EOF or ctx canceled.
+// The progress of the stages is logged every logInterval.
+func (p *Pipeline) Run(ctx context.Context, inputs *Inputs, w *BatchWriter, logInterval time.Duration) error {
+	if p.Rejects == nil {
+		p.Rejects, _ = NewRejects(nil, "", "", false)
+	}
+
+	p.read = stageStats{name: "read", unit: "lines"}
+	p.parse = stageStats{name: "parse", unit: "lines"}
+	p.write = stageStats{name: "write", unit: "records"}
+	p.aborted = make(chan struct{})
+
+	rp, err := p.Parser()
+	if err != nil {
+		return err
+	}
+
+	workerParsers := make([]RecordParser, p.Workers)
+	for i := range workerParsers {
+		if workerParsers[i], err = p.Parser(); err != nil {
+			return err
+		}
+	}
+
+	// inflight bounds the chunks between the reader and the writer, including the ones in the reorder buffer.
+	inflight := make(chan struct{}, 4*p.Workers)
+	chunks := make(chan *lineChunk, p.Workers)
+	results := make(chan *lineChunk, p.Workers)
+	readErr := make(chan error, 1)
+
+	go func() { readErr <- p.readChunks(ctx, inputs, chunks, inflight) }()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < p.Workers; i++ {
+		wg.Add(1)
+
+		go func(rp RecordParser) {
+			defer wg.Done()
+
+			for c := range chunks {
+				p.parseChunk(rp, c)
+
+				select {
+				case results <- c:
+				case <-p.aborted:
+					return
+				}
+			}
+		}(workerParsers[i])
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	stop := p.logProgress(logInterval)
+	err = p.writeChunks(ctx, rp, results, inflight, w)
+	stop()
+
+	if err != nil {
+		// Not waiting for the reader, which may be blocked on reading stdin or a followed file,
+		// it stops at its next line sent.
+		close(p.aborted)
+	} else {
+		err = <-readErr
+	}
+
+	p.logSummary()
+
+	return err
+}
+
+// readChunks dispatches the lines in chunks, until the lines are closed by the scan after EOF or ctx canceled,
+// so that the lines scanned are all parsed and written.
+func (p *Pipeline) readChunks(ctx context.Context, inputs *Inputs, chunks chan<- *lineChunk,
+	inflight chan struct{}) error {
+	defer close(chunks)
+
+	lines := make(chan scannedLine, p.ChunkLines)
+	scanErr := make(chan error, 1)
+
+	go func() { scanErr <- p.scan(ctx, inputs, lines) }()
+
+	var flush <-chan time.Time
+
+	newChunk := func(seq int) *lineChunk {
+		return &lineChunk{seq: seq, lines: make([][]byte, 0, p.ChunkLines), pos: make([]linePos, 0, p.ChunkLines)}
+	}
+
+	c := newChunk(0)
+	send := func() bool {
+		flush = nil
+
+		if len(c.lines) == 0 {
+			return true
+		}
+
+		select {
+		case inflight <- struct{}{}:
+		case <-p.aborted:
+			return false
+		}
+
+		select {
+		case chunks <- c:
+		case <-p.aborted:
+			return false
+		}
+
+		c = newChunk(c.seq + 1)
+
+		return true
+	}
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				if !send() {
+					return errAborted
+				}
+
+				return <-scanErr
+			}
+
+			c.lines, c.pos = append(c.lines, line.line), append(c.pos, line.pos)
+			if len(c.lines) == 1 && p.FlushInterval > 0 {
+				flush = time.After(p.FlushInterval)
+			}
+
+			if len(c.lines) == p.ChunkLines && !send() {
+				return errAborted
+			}
+		case <-flush:
+			if !send() {
+				return errAborted
+			}
+		}
+	}
+}
+
+// scan splits the lines of the input files one by one until EOF or ctx canceled.
+func (p *Pipeline) scan(ctx context.Context, inputs *Inputs, lines chan<- scannedLine) error {
+	defer close(lines)
+
+	for ctx.Err() == nil {
+		in, err := inputs.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		err = p.scanFile(ctx, in, lines)
+		_ = in.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scanFile splits the lines of the input file, with the offsets of their ends.
+func (p *Pipeline) scanFile(ctx context.Context, in *InputFile, lines chan<- scannedLine) error {
+	start, end := in.Offset, in.Offset
+	split := p.Start.Split()
+
+	scanner := bufio.NewScanner(in)
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		if advance > 0 {
+			start, end = end, end+int64(advance)
+		}
+
+		return advance, token, err
+	})
+
+	for t := time.Now(); scanner.Scan(); t = time.Now() {
+		// The bytes of the scanner are overwritten by the next scan.
+		line := append([]byte(nil), bytes.TrimSpace(scanner.Bytes())...)
+		p.read.busy.Add(time.Since(t))
+		p.read.count.Inc()
+
+		select {
+		case lines <- scannedLine{line: line, pos: linePos{in: in, start: start, end: end}}:
+		case <-p.aborted:
+			return errAborted
+		}
+
+		// Checked after the line sent, the last line of the followed file is returned after ctx canceled.
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("scan %s error: %w", in.Name, err)
+	}
+
+	return nil
+}
+
+// parseChunk parses the lines of the chunk, with the line index speculated from 0 at the start of the chunk.
+func (p *Pipeline) parseChunk(rp RecordParser, c *lineChunk) {
+	start := time.Now()
+	c.parsed = make([]parsedLine, len(c.lines))
+	idx := 0
+
+	for i, line := range c.lines {
+		m, ok := rp.Parse(idx, line)
+		c.parsed[i] = parsedLine{idx: idx, values: m, ok: ok}
+
+		if !ok {
+			idx = 0
+		} else if idx++; idx == rp.Lines() {
+			idx = 0
+		}
+	}
+
+	p.parse.busy.Add(time.Since(start))
+	p.parse.count.Add(int64(len(c.lines)))
+}
+
+// writeChunks reassembles the parsed chunks in order by the reorder buffer, and adds the records to w.
+// The chunks read before ctx canceled are still written.
+func (p *Pipeline) writeChunks(ctx context.Context, rp RecordParser, results <-chan *lineChunk,
+	inflight <-chan struct{}, w *BatchWriter) error {
+	ctx = context.Background() // not canceled with the reads, to write the chunks read before.
+	pending := make(map[int]*lineChunk)
+	next := 0
+	a := &assembler{recordAssembler: newRecordAssembler(rp, p.Converters, p.DynamicColumns), p: p, w: w}
+
+	var flush <-chan time.Time
+
+	if p.FlushInterval > 0 {
+		ticker := time.NewTicker(p.FlushInterval)
+		defer ticker.Stop()
+
+		flush = ticker.C
+	}
+
+	for {
+		var c *lineChunk
+
+		select {
+		case <-flush:
+			if err := p.Rejects.Flush(ctx, w); err != nil {
+				return err
+			}
+
+			if err := w.Flush(ctx); err != nil {
+				return err
+			}
+
+			continue
+		case r, ok := <-results:
+			if !ok {
+				return a.close(ctx)
+			}
+
+			c = r
+		}
+
+		pending[c.seq] = c
+
+		for c, ok := pending[next]; ok; c, ok = pending[next] {
+			delete(pending, next)
+			next++
+
+			start := time.Now()
+			records := 0
+
+			for i, l := range c.parsed {
+				record, err := a.add(ctx, c.lines[i], c.pos[i], l)
+				if err != nil {
+					return err
+				}
+
+				if record {
+					records++
+				}
+			}
+
+			p.write.busy.Add(time.Since(start))
+			p.write.count.Add(int64(records))
+			<-inflight
+		}
+	}
+}
+
+// recordAssembler assembles the records of the lines parsed by the patterns in order,
+// shared by the pipeline and the logline test.
+type recordAssembler struct {
+	rp    RecordParser
+	convs Converters
+	// dynamic rejects the records of only nulls, which have no columns to insert into.
+	dynamic bool
+
+	idx    int
+	values map[string]interface{}
+	// partial are the lines of the multi-lines record being assembled, rejected if a line not matched in the middle.
+	partial []RejectedLine
+}
+
+func newRecordAssembler(rp RecordParser, convs Converters, dynamic bool) recordAssembler {
+	return recordAssembler{rp: rp, convs: convs, dynamic: dynamic, values: make(map[string]interface{})}
+}
+
+// add adds the line of the file at offset, parsed by the pattern of the speculated index as l, and tells whether
+// the line matched, and whether all the lines of the record matched. The record is reset by the caller after
+// the record completed or the line not matched.
+func (a *recordAssembler) add(line []byte, file string, offset int64, l parsedLine) (matched, complete bool) {
+	if l.idx != a.idx { // speculated wrong, parse again by the right index.
+		l.values, l.ok = a.rp.Parse(a.idx, line)
+	}
+
+	if !l.ok {
+		return false, false
+	}
+
+	a.convs.Apply(l.values)
+	merge(l.values, a.values)
+
+	if a.idx+1 < a.rp.Lines() {
+		a.partial = append(a.partial, RejectedLine{File: file, Offset: offset, Pattern: a.idx, Line: string(line)})
+		a.idx++
+
+		return true, false
+	}
+
+	if a.dynamic && !hasValue(a.values) { // e.g. {"a":null} of JSON, no column to insert into.
+		return false, false
+	}
+
+	return true, true
+}
+
+// addLine adds the line not parsed yet, parsed by the pattern of the current index.
+func (a *recordAssembler) addLine(line []byte, file string, offset int64) (matched, complete bool) {
+	return a.add(line, file, offset, parsedLine{idx: -1})
+}
+
+// reset resets the record to assemble the next one from the first pattern.
+func (a *recordAssembler) reset() {
+	a.idx, a.partial = 0, a.partial[:0]
+	a.values = make(map[string]interface{})
+}
+
+// assembler assembles the records of the parsed lines in order and writes them, and rejects the lines not parsed.
+type assembler struct {
+	recordAssembler
+
+	p *Pipeline
+	w *BatchWriter
+}
+
+// add adds the line parsed, and writes the record when all the lines of it are matched.
+func (a *assembler) add(ctx context.Context, line []byte, pos linePos, l parsedLine) (record bool, err error) {
+	matched, complete := a.recordAssembler.add(line, pos.in.Name, pos.start, l)
+	if !matched {
+		return false, a.reject(ctx, line, pos)
+	}
+
+	if !complete {
+		return false, nil
+	}
+
+	if a.p.DynamicColumns {
+		if err := a.evolveColumns(ctx); err != nil {
+			return false, err
+		}
+	}
+
+	// Marked before added, the checkpoint is saved with the record if committed by AddRecord.
+	a.mark(pos)
+
+	if err := a.w.AddRecord(ctx, a.values); err != nil {
+		return false, err
+	}
+
+	a.reset()
+
+	return true, nil
+}
+
+// evolveColumns adds the columns of the keys of the record not in the table yet, typed by their values,
+// widens the columns of the values drifted from their types, e.g. a float or a string into an integer column,
+// and converts the values of the text columns into strings.
+func (a *assembler) evolveColumns(ctx context.Context) error {
+	var added, widened []Column
+
+	for name, v := range a.values {
+		if v == nil {
+			continue
+		}
+
+		c, ok := a.w.Column(name)
+		switch {
+		case !ok:
+			added = append(added, dynamicColumn(name, v))
+		case textColumn(c):
+			if _, ok := v.(string); !ok {
+				a.values[name] = fmt.Sprint(v)
+			}
+		default:
+			if wc, ok := widenColumn(c, v); ok {
+				log.Printf("Column %s of %s widened to %s by the value %v", c.Name, a.w.t.Name, wc.typeName(a.w.d), v)
+				widened = append(widened, wc)
+			}
+		}
+	}
+
+	if len(added) == 0 && len(widened) == 0 {
+		return nil
+	}
+
+	// The records and the rejected lines before are committed before the table altered.
+	if err := a.p.Rejects.Flush(ctx, a.w); err != nil {
+		return err
+	}
+
+	if len(widened) > 0 {
+		sort.Slice(widened, func(i, j int) bool { return widened[i].Name < widened[j].Name })
+
+		if err := a.w.WidenColumns(ctx, widened...); err != nil {
+			return err
+		}
+	}
+
+	if len(added) == 0 {
+		return nil
+	}
+
+	sort.Slice(added, func(i, j int) bool { return added[i].Name < added[j].Name })
+
+	return a.w.AddColumns(ctx, added...)
+}
+
+func hasValue(values map[string]interface{}) bool {
+	for _, v := range values {
+		if v != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reject rejects the line, with the lines of the partial record before it.
+func (a *assembler) reject(ctx context.Context, line []byte, pos linePos) error {
+	if err := a.rejectPartial(ctx); err != nil {
+		return err
+	}
+
+	l := RejectedLine{File: pos.in.Name, Offset: pos.start, Pattern: a.idx, Line: string(line)}
+	if err := a.p.Rejects.Add(ctx, a.w, l); err != nil {
+		return err
+	}
+
+	// The rejected lines are committed with the records, not to be rejected again when resumed.
+	a.mark(pos)
+	a.reset()
+
+	return nil
+}
+
+// rejectPartial rejects the lines of the partial record as an incomplete record.
+func (a *assembler) rejectPartial(ctx context.Context) error {
+	if len(a.partial) == 0 {
+		return nil
+	}
+
+	a.p.Rejects.Incomplete++
+
+	for _, l := range a.partial {
+		if err := a.p.Rejects.Add(ctx, a.w, l); err != nil {
+			return err
+		}
+	}
+
+	a.partial = a.partial[:0]
+
+	return nil
+}
+
+func (a *assembler) mark(pos linePos) {
+	if a.p.Checkpoints != nil {
+		a.p.Checkpoints.Mark(pos.in.ID, pos.end)
+	}
+}
+
+// close rejects the lines of the partial record at the end of the inputs, and flushes the rejected lines.
+func (a *assembler) close(ctx context.Context) error {
+	if err := a.rejectPartial(ctx); err != nil {
+		return err
+	}
+
+	return a.p.Rejects.Flush(ctx, a.w)
+}
+
+// logProgress logs the counts and rates of the stages every interval until stopped.
+func (p *Pipeline) logProgress(interval time.Duration) (stop func()) {
+	start := time.Now()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				dur := time.Since(start).Seconds()
+				parts := make([]string, 0, 3)
+
+				for _, s := range []*stageStats{&p.read, &p.parse, &p.write} {
+					n := s.count.Load()
+					parts = append(parts, fmt.Sprintf("%s %d %s(%.2f %s/s)", s.name, n, s.unit, float64(n)/dur, s.unit))
+				}
+
+				log.Printf("%s in %s", strings.Join(parts, ", "), time.Since(start).Truncate(time.Millisecond))
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// logSummary logs the rate of each stage on its own, the lowest one is the bottleneck of the pipeline.
+func (p *Pipeline) logSummary() {
+	for _, s := range []struct {
+		*stageStats
+		parallel int
+	}{{&p.read, 1}, {&p.parse, p.Workers}, {&p.write, 1}} {
+		log.Printf("Stage %s: %d %s, busy %s over %d goroutines, %.2f %s/s", s.name, s.count.Load(), s.unit,
+			s.busy.Load().Truncate(time.Millisecond), s.parallel, s.rate(s.parallel), s.unit)
+	}
+
+	p.Rejects.LogSummary(p.write.count.Load(), p.read.count.Load(), 10)
+	p.Converters.LogFailures()
+}
@@ -0,0 +1,416 @@
+package sqlite3perf
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeParser parses the line like "1 a=x b=y" by the pattern of the index 1, null values as NULL.
+type fakeParser struct{ lines int }
+
+func (p fakeParser) Lines() int { return p.lines }
+
+func (p fakeParser) Parse(idx int, line []byte) (map[string]interface{}, bool) {
+	fields := strings.Fields(string(line))
+	if len(fields) == 0 || fields[0] != strconv.Itoa(idx) {
+		return nil, false
+	}
+
+	values := make(map[string]interface{})
+
+	for _, f := range fields[1:] {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return nil, false
+		}
+
+		if values[kv[0]] = kv[1]; kv[1] == "null" {
+			values[kv[0]] = nil
+		}
+	}
+
+	return values, true
+}
+
+// assemblerTest assembles the chunks of the lines into the table t of a new SQLite database.
+type assemblerTest struct {
+	db *sql.DB
+	p  *Pipeline
+	w  *BatchWriter
+	a  *assembler
+}
+
+func newAssemblerTest(t *testing.T, rp RecordParser, columns []Column, txSize int) *assemblerTest {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "a.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = db.Close() })
+
+	tbl := Table{Name: "t", Columns: columns}
+	if len(columns) > 0 {
+		if _, err := EvolveTable(db, tbl, SchemaDefault, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := NewBatchWriter(db, tbl, ConflictPlain, 1, txSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Pipeline{DynamicColumns: len(columns) == 0}
+	if p.Rejects, err = NewRejects(db, "t", "", true); err != nil {
+		t.Fatal(err)
+	}
+
+	a := &assembler{recordAssembler: newRecordAssembler(rp, nil, p.DynamicColumns), p: p, w: w}
+
+	return &assemblerTest{db: db, p: p, w: w, a: a}
+}
+
+// add parses the chunks of the lines with the line index speculated like the parser workers, and adds them.
+func (at *assemblerTest) add(t *testing.T, chunks [][]string) {
+	t.Helper()
+
+	in := &InputFile{Name: "t.log", ID: FileID{Path: "t.log", HeadHash: "head"}}
+	offset := int64(0)
+
+	for _, lines := range chunks {
+		c := &lineChunk{}
+
+		for _, l := range lines {
+			c.lines = append(c.lines, []byte(l))
+			c.pos = append(c.pos, linePos{in: in, start: offset, end: offset + int64(len(l)) + 1})
+			offset += int64(len(l)) + 1
+		}
+
+		at.p.parseChunk(at.a.rp, c)
+
+		for i := range c.lines {
+			if _, err := at.a.add(context.Background(), c.lines[i], c.pos[i], c.parsed[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+// close rejects the partial record and commits all.
+func (at *assemblerTest) close(t *testing.T) {
+	t.Helper()
+
+	if err := at.a.close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := at.w.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// query returns the rows of the query, the columns joined by comma, NULL as empty.
+func (at *assemblerTest) query(t *testing.T, query string) []string {
+	t.Helper()
+
+	rows, err := at.db.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	columns, _ := rows.Columns()
+
+	var result []string
+
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			t.Fatal(err)
+		}
+
+		fields := make([]string, len(values))
+		for i, v := range values {
+			fields[i] = v.String
+		}
+
+		result = append(result, strings.Join(fields, ","))
+	}
+
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
+
+func TestAssembler(t *testing.T) {
+	columns := []Column{{Name: "a", Type: TypeText}, {Name: "b", Type: TypeText}}
+
+	tests := []struct {
+		name    string
+		chunks  [][]string
+		records []string
+		rejects []string
+	}{
+		{
+			name:    "single chunk",
+			chunks:  [][]string{{"0 a=1", "1 b=2", "0 a=3", "1 b=4"}},
+			records: []string{"1,2", "3,4"},
+		},
+		{
+			name:    "speculated wrong at the chunk starts",
+			chunks:  [][]string{{"0 a=1"}, {"1 b=2", "0 a=3"}, {"1 b=4"}},
+			records: []string{"1,2", "3,4"},
+		},
+		{
+			name:    "failure at the first line",
+			chunks:  [][]string{{"x", "0 a=1", "1 b=2"}},
+			records: []string{"1,2"},
+			rejects: []string{"0,x"},
+		},
+		{
+			name:    "failure at the second line",
+			chunks:  [][]string{{"0 a=1", "x", "0 b=7", "1 b=8"}},
+			records: []string{",8"},
+			rejects: []string{"0,0 a=1", "1,x"},
+		},
+		{
+			name:    "incomplete record at the end",
+			chunks:  [][]string{{"0 a=1", "1 b=2", "0 a=3"}},
+			records: []string{"1,2"},
+			rejects: []string{"0,0 a=3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := newAssemblerTest(t, fakeParser{lines: 2}, columns, 0)
+			at.add(t, tt.chunks)
+			at.close(t)
+
+			if got := at.query(t, "SELECT a, b FROM t ORDER BY rowid"); !reflect.DeepEqual(got, tt.records) {
+				t.Errorf("records = %q, want %q", got, tt.records)
+			}
+
+			if got := at.query(t, "SELECT pattern, line FROM t_rejects ORDER BY id"); !reflect.DeepEqual(got, tt.rejects) {
+				t.Errorf("rejects = %q, want %q", got, tt.rejects)
+			}
+		})
+	}
+}
+
+func TestAssemblerRejectsBeforeCommit(t *testing.T) {
+	columns := []Column{{Name: "a", Type: TypeText}}
+
+	tests := []struct {
+		name    string
+		lines   []string
+		records []string
+		rejects []string
+	}{
+		{
+			name:    "rejected before the first commit",
+			lines:   []string{"x", "0 a=1"},
+			records: []string{"1"},
+			rejects: []string{"x"},
+		},
+		{
+			name:    "rejected between the commits",
+			lines:   []string{"0 a=1", "y", "0 a=2"},
+			records: []string{"1", "2"},
+			rejects: []string{"y"},
+		},
+		{
+			name:    "rejected after the last commit",
+			lines:   []string{"0 a=1", "z"},
+			records: []string{"1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A transaction per record, which saves the checkpoint of the record.
+			at := newAssemblerTest(t, fakeParser{lines: 1}, columns, 1)
+			at.w.BeforeCommit = at.p.BeforeCommit
+
+			var err error
+			if at.p.Checkpoints, err = LoadCheckpoints(at.db, "t"); err != nil {
+				t.Fatal(err)
+			}
+
+			// Not closed, as if killed after the last commit.
+			at.add(t, [][]string{tt.lines})
+
+			if got := at.query(t, "SELECT a FROM t ORDER BY rowid"); !reflect.DeepEqual(got, tt.records) {
+				t.Errorf("records = %q, want %q", got, tt.records)
+			}
+
+			// The rejected lines before the checkpoint are committed, not to be lost when resumed.
+			if got := at.query(t, "SELECT line FROM t_rejects ORDER BY id"); !reflect.DeepEqual(got, tt.rejects) {
+				t.Errorf("rejects = %q, want %q", got, tt.rejects)
+			}
+		})
+	}
+}
+
+func TestAssemblerDynamicColumns(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		records []string
+		rejects []string
+	}{
+		{
+			name:    "columns added",
+			lines:   []string{"0 a=1", "0 a=2 b=3"},
+			records: []string{"1,", "2,3"},
+		},
+		{
+			name:    "only nulls before the columns",
+			lines:   []string{"0 a=null", "0 a=1", "0 a=x"},
+			records: []string{"1", "x"},
+			rejects: []string{"0 a=null"},
+		},
+		{
+			name:    "only nulls after the columns",
+			lines:   []string{"0 a=1", "0 a=null b=null", "0 b=2"},
+			records: []string{"1,", ",2"},
+			rejects: []string{"0 a=null b=null"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := newAssemblerTest(t, fakeParser{lines: 1}, nil, 0)
+			at.add(t, [][]string{tt.lines})
+			at.close(t)
+
+			if got := at.query(t, "SELECT * FROM t ORDER BY rowid"); !reflect.DeepEqual(got, tt.records) {
+				t.Errorf("records = %q, want %q", got, tt.records)
+			}
+
+			if got := at.query(t, "SELECT line FROM t_rejects ORDER BY id"); !reflect.DeepEqual(got, tt.rejects) {
+				t.Errorf("rejects = %q, want %q", got, tt.rejects)
+			}
+		})
+	}
+}
+
+func TestRecordAssembler(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  []string
+		want   map[string]interface{}
+		failed int
+	}{
+		{
+			name:  "complete",
+			lines: []string{"0 a=1", "1 b=2"},
+			want:  map[string]interface{}{"a": "1", "b": "2"},
+		},
+		{
+			name:   "values of the failed record cleared",
+			lines:  []string{"0 a=1", "x", "0 b=7", "1 b=8"},
+			want:   map[string]interface{}{"b": "8"},
+			failed: 1,
+		},
+		{
+			name:   "failure at the first line",
+			lines:  []string{"x", "0 a=1", "1 b=2"},
+			want:   map[string]interface{}{"a": "1", "b": "2"},
+			failed: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newRecordAssembler(fakeParser{lines: 2}, nil, false)
+			failed := 0
+
+			for i, l := range tt.lines {
+				matched, complete := a.addLine([]byte(l), "t.log", int64(i))
+				if !matched {
+					failed++
+					a.reset()
+
+					continue
+				}
+
+				if complete && i < len(tt.lines)-1 {
+					t.Fatalf("addLine(%s) completed before the last line", l)
+				}
+			}
+
+			if !reflect.DeepEqual(a.values, tt.want) || failed != tt.failed {
+				t.Errorf("values = %v, %d failed, want %v, %d failed", a.values, failed, tt.want, tt.failed)
+			}
+		})
+	}
+}
+
+func TestPipelineRunWriterFailed(t *testing.T) {
+	columns := []Column{{Name: "a", Type: TypeText, PrimaryKey: true}}
+
+	tests := []struct {
+		name  string
+		first string
+	}{
+		{name: "duplicate key at the start", first: "0 a=0"},
+		{name: "duplicate key after the channels filled", first: "0 a=500"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines strings.Builder
+
+			lines.WriteString(tt.first + "\n")
+
+			for i := 0; i < 1000; i++ {
+				fmt.Fprintf(&lines, "0 a=%d\n", i)
+			}
+
+			file := filepath.Join(t.TempDir(), "t.log")
+			if err := os.WriteFile(file, []byte(lines.String()), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			inputs, err := OpenInputs(context.Background(), file, InputOptions{Order: "name"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			at := newAssemblerTest(t, nil, columns, 0)
+			at.p.Parser = func() (RecordParser, error) { return fakeParser{lines: 1}, nil }
+			at.p.Workers, at.p.ChunkLines = 2, 1
+
+			done := make(chan error, 1)
+			go func() { done <- at.p.Run(context.Background(), inputs, at.w, time.Hour) }()
+
+			select {
+			case err := <-done:
+				if err == nil || !strings.Contains(err.Error(), "UNIQUE") {
+					t.Errorf("Run() error = %v, want the UNIQUE constraint failed", err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("Run() blocked after the writer failed")
+			}
+		})
+	}
+}
@@ -1,17 +1,38 @@
 package sqlite3perf
 
 import (
+	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"log"
+	"os"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // PragmaCmd is the struct representing pragma sub-command.
 type PragmaCmd struct {
+	// All dumps all the readable PRAGMAs.
+	All bool
+	// Diff is the other database to compare the readable PRAGMAs with.
+	Diff string
+	// Force runs the PRAGMAs unknown to the catalog.
+	Force bool
+}
+
+// readablePragmas are the PRAGMAs which can be queried without arguments and side effects.
+// nolint:gochecknoglobals
+var readablePragmas = []string{
+	"application_id", "auto_vacuum", "automatic_index", "busy_timeout", "cache_size", "cache_spill",
+	"cell_size_check", "checkpoint_fullfsync", "collation_list", "compile_options", "data_version",
+	"database_list", "defer_foreign_keys", "encoding", "foreign_keys", "freelist_count", "fullfsync",
+	"hard_heap_limit", "ignore_check_constraints", "journal_mode", "journal_size_limit", "legacy_alter_table",
+	"locking_mode", "max_page_count", "mmap_size", "page_count", "page_size", "query_only", "read_uncommitted",
+	"recursive_triggers", "reverse_unordered_selects", "secure_delete", "soft_heap_limit", "synchronous",
+	"temp_store", "threads", "trusted_schema", "user_version", "wal_autocheckpoint",
 }
 
 // nolint:gochecknoinits
@@ -24,65 +45,253 @@ func init() {
 like:
 1). sqlite3perf pragma synchronous auto_vacuum journal_mode
 2). sqlite3perf pragma synchronous=0 auto_vacuum=NONE
+3). sqlite3perf pragma "table_info(bench)" compile_options integrity_check
+4). sqlite3perf pragma --all
+5). sqlite3perf pragma --diff other.db
 `,
 		Run: c.run,
 	}
 
 	rootCmd.AddCommand(cmd)
+	c.initFlags(cmd.Flags())
 }
 
-func (g *PragmaCmd) run(cmd *cobra.Command, args []string) {
-	log.Printf("Generating records by config %+v", g)
+func (g *PragmaCmd) initFlags(f *pflag.FlagSet) {
+	f.BoolVar(&g.All, "all", false, "dump all the readable PRAGMAs")
+	f.StringVar(&g.Diff, "diff", "", "other database file to compare the readable PRAGMAs with, opened read-only")
+	f.BoolVar(&g.Force, "force", false, "run the PRAGMAs unknown to the catalog")
+}
 
-	log.Print("Opening database")
-	// Database Setup
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		log.Fatalf("Error while opening database '%s': %s", dbPath, err.Error())
+func (g *PragmaCmd) run(cmd *cobra.Command, args []string) {
+	if d := DriverDialect(driverName); d != SQLite {
+		log.Fatalf("pragma is only supported by %s, not %s", SQLite, d)
 	}
-	defer db.Close()
 
-	for _, v := range args {
-		keyValues := strings.SplitN(v, "=", 2)
-		key := keyValues[0]
-		value := ""
+	db := openDB(dbPath, 1)
+	defer db.Close()
 
-		if len(keyValues) > 1 {
-			value = keyValues[1]
+	pragmas := make([]Pragma, len(args))
+	for i, v := range args {
+		p, err := ParsePragma(v, g.Force)
+		if err != nil {
+			log.Fatal(err)
 		}
 
-		if !queryPragma(db, key) || value == "" {
+		pragmas[i] = p
+	}
+
+	for _, p := range pragmas {
+		if !queryPragma(db, p.Key()) && p.Value == "" {
 			continue
 		}
 
-		alterPragma(db, key, value, v)
-		queryPragma(db, key)
+		if p.Value != "" {
+			alterPragma(db, p)
+			queryPragma(db, p.Key())
+		}
+	}
+
+	if g.All {
+		dumpPragmas(db)
+	}
+
+	if g.Diff != "" {
+		other := openReadOnly(g.Diff)
+		defer other.Close()
+
+		diffPragmas(dbPath, db, g.Diff, other)
 	}
 }
 
-func alterPragma(db *sql.DB, key string, value string, v string) {
-	_, err := db.Exec(fmt.Sprintf("PRAGMA %s=%s", key, value))
+// openReadOnly opens the existing database file read-only, as is without the DSN options,
+// so that comparing with it neither creates nor changes it.
+func openReadOnly(path string) *sql.DB {
+	if _, err := os.Stat(path); err != nil {
+		log.Fatalf("database %s error: %v", path, err)
+	}
+
+	db, err := sql.Open(driverName, "file:"+path+"?mode=ro")
 	if err != nil {
+		log.Fatalf("Error while opening database '%s': %s", path, err.Error())
+	}
+
+	db.SetMaxOpenConns(1)
+
+	return db
+}
+
+func alterPragma(db *sql.DB, p Pragma) {
+	if _, err := db.Exec("PRAGMA " + p.Key() + "=" + p.Value); err != nil {
 		log.Fatal(err)
 	}
 
-	log.Printf("set PRAGMA %s successfully", v)
+	switch {
+	case !p.Known:
+		log.Printf("set PRAGMA %s=%s successfully, scope unknown", p.Key(), p.Value)
+	case p.Info.Scope == PragmaConnection:
+		log.Printf("set PRAGMA %s=%s successfully, %s: lost when the connection is closed or reconnected by the pool",
+			p.Key(), p.Value, p.Info)
+	default:
+		log.Printf("set PRAGMA %s=%s successfully, %s", p.Key(), p.Value, p.Info)
+	}
 }
 
+// queryPragma queries the PRAGMA, logs the value of a single value result, or prints the rows in a table.
 func queryPragma(db *sql.DB, key string) bool {
-	row := db.QueryRow("PRAGMA " + key)
-	previousValue := ""
-	err := row.Scan(&previousValue)
+	columns, rows, err := QueryPragmaRows(db, key)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			log.Printf("Unknown PRAGMA %s", key)
-			return false
-		}
-
 		log.Fatal(err)
 	}
 
-	log.Printf("get PRAGMA %s=%s", key, previousValue)
+	switch {
+	case len(rows) == 0:
+		log.Printf("PRAGMA %s returned nothing, unknown or empty", key)
+		return false
+	case len(rows) == 1 && len(columns) == 1:
+		log.Printf("get PRAGMA %s=%s", key, rows[0][0])
+	default:
+		log.Printf("get PRAGMA %s, %d rows", key, len(rows))
+		printRows(columns, rows)
+	}
 
 	return true
 }
+
+// QueryPragmaRows returns the columns and the rows of the PRAGMA, with NULL as an empty string.
+func QueryPragmaRows(db *sql.DB, key string) (columns []string, rows [][]string, err error) {
+	r, err := db.Query("PRAGMA " + key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("PRAGMA %s: %w", key, err)
+	}
+	defer r.Close()
+
+	if columns, err = r.Columns(); err != nil {
+		return nil, nil, err
+	}
+
+	for r.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+
+		if err := r.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+
+		row := make([]string, len(columns))
+		for i, v := range values {
+			row[i] = v.String
+		}
+
+		rows = append(rows, row)
+	}
+
+	return columns, rows, r.Err()
+}
+
+// readPragmas queries all the readable PRAGMAs, the values of multi-row or multi-column ones are joined,
+// and the unknown ones to the SQLite version are left out.
+func readPragmas(db *sql.DB) map[string]string {
+	values := make(map[string]string, len(readablePragmas))
+
+	for _, name := range readablePragmas {
+		_, rows, err := QueryPragmaRows(db, name)
+		if err != nil || len(rows) == 0 {
+			continue
+		}
+
+		joined := make([]string, len(rows))
+		for i, row := range rows {
+			joined[i] = strings.Join(row, "|")
+		}
+
+		values[name] = strings.Join(joined, ", ")
+	}
+
+	return values
+}
+
+func dumpPragmas(db *sql.DB) {
+	values := readPragmas(db)
+	rows := make([][]string, 0, len(values))
+
+	for _, name := range readablePragmas {
+		if v, ok := values[name]; ok {
+			rows = append(rows, []string{name, pragmaCatalog[name].Scope, v})
+		}
+	}
+
+	printRows([]string{"pragma", "scope", "value"}, rows)
+}
+
+func diffPragmas(name1 string, db1 *sql.DB, name2 string, db2 *sql.DB) {
+	values1, values2 := readPragmas(db1), readPragmas(db2)
+
+	var rows [][]string
+
+	for _, name := range readablePragmas {
+		// database_list contains the file paths, data_version is local to the connection.
+		if name == "database_list" || name == "data_version" {
+			continue
+		}
+
+		if v1, v2 := values1[name], values2[name]; v1 != v2 {
+			rows = append(rows, []string{name, v1, v2})
+		}
+	}
+
+	if len(rows) == 0 {
+		fmt.Printf("No differences of PRAGMAs between %s and %s\n", name1, name2)
+		return
+	}
+
+	printRows([]string{"pragma", name1, name2}, rows)
+}
+
+func printRows(columns []string, rows [][]string) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, strings.Join(columns, "\t"))
+
+	for _, row := range rows {
+		_, _ = fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	_ = w.Flush()
+}
+
+// PragmaValueEquals tells whether the value got by querying the PRAGMA equals to the value set.
+func PragmaValueEquals(name, set, got string) bool {
+	if strings.EqualFold(set, got) {
+		return true
+	}
+
+	if n, ok := pragmaCatalog[name].Enum[strings.ToUpper(set)]; ok {
+		return n == got
+	}
+
+	switch strings.ToLower(set) {
+	case "on", "true", "yes":
+		return got == "1"
+	case "off", "false", "no":
+		return got == "0"
+	}
+
+	return false
+}
+
+// QueryPragmaValue returns the value of the PRAGMA.
+func QueryPragmaValue(db pragmaConn, name string) (value string, err error) {
+	err = db.QueryRowContext(context.Background(), "PRAGMA "+name).Scan(&value)
+	return value, err
+}
+
+func splitPragma(p string) (name, value string) {
+	keyValues := strings.SplitN(p, "=", 2)
+	if len(keyValues) > 1 {
+		value = keyValues[1]
+	}
+
+	return strings.TrimSpace(keyValues[0]), strings.TrimSpace(value)
+}
@@ -0,0 +1,246 @@
+package sqlite3perf
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	// rejectPrefixLen is the length of the prefixes the unmatched lines are counted by.
+	rejectPrefixLen = 40
+	// rejectMaxPrefixes bounds the distinct prefixes counted, the others are counted as other.
+	rejectMaxPrefixes = 10000
+	// rejectBatchSize is the number of the rejected lines inserted at one time.
+	rejectBatchSize = 100
+)
+
+// Rejects counts the lines not parsed by the patterns by their prefixes, and writes them to the JSON lines file
+// and(or) the <table>_rejects table, which are inserted in the transaction of the records.
+// The JSON lines file is outside the transaction, so the lines rejected after the last checkpoint are written again
+// when resumed, which are the duplicates of the same file and offset.
+type Rejects struct {
+	// Lines is the number of the rejected lines.
+	Lines int64
+	// Incomplete is the number of the multi-lines records rejected by a line not matched in the middle.
+	Incomplete int64
+
+	prefixes map[string]int64
+
+	file *os.File
+	out  *bufio.Writer
+	enc  *json.Encoder
+
+	t     *Table
+	d     Dialect
+	batch []interface{}
+}
+
+// RejectedLine is a line not parsed by the pattern.
+type RejectedLine struct {
+	File string `json:"file"`
+	// Offset is the offset of the start of the line in the (decompressed) file.
+	Offset int64 `json:"offset"`
+	// Pattern is the index of the pattern the line is parsed by.
+	Pattern int    `json:"pattern"`
+	Line    string `json:"line"`
+}
+
+// rejectsTable returns the table of the rejected lines of the table.
+func rejectsTable(table string) Table {
+	return Table{
+		Name:    table + "_rejects",
+		Comment: "lines not parsed by the patterns of logline",
+		Columns: []Column{
+			{Name: "id", Type: TypeBigInt, PrimaryKey: true, AutoIncrement: true},
+			{Name: "file", Type: TypeVarchar, Size: 1024, NotNull: true},
+			{Name: "line_offset", Type: TypeBigInt, NotNull: true},
+			{Name: "pattern", Type: TypeInt, NotNull: true},
+			{Name: "line", Type: TypeText, NotNull: true},
+		},
+	}
+}
+
+// NewRejects creates the Rejects writing to the file if not empty, and to the <table>_rejects table if toTable.
+func NewRejects(db *sql.DB, table, file string, toTable bool) (*Rejects, error) {
+	r := &Rejects{prefixes: make(map[string]int64)}
+
+	if file != "" {
+		f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return nil, err
+		}
+
+		r.file, r.out = f, bufio.NewWriter(f)
+		r.enc = json.NewEncoder(r.out)
+	}
+
+	if toTable {
+		t := rejectsTable(table)
+		r.t, r.d = &t, DriverDialect(driverName)
+
+		createTable, err := t.CreateSQL(r.d, SchemaDefault)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := db.Exec(createTable); err != nil {
+			// maybe already created, just print error and continue.
+			log.Printf("create table %s: %s", createTable, err)
+		}
+	}
+
+	return r, nil
+}
+
+// Add counts the rejected line, and writes it.
+func (r *Rejects) Add(ctx context.Context, w *BatchWriter, l RejectedLine) error {
+	r.Lines++
+	r.countPrefix(l.Line)
+
+	if r.enc != nil {
+		if err := r.enc.Encode(l); err != nil {
+			return err
+		}
+	}
+
+	if r.t == nil {
+		return nil
+	}
+
+	if r.batch = append(r.batch, l.File, l.Offset, l.Pattern, l.Line); len(r.batch) >= rejectBatchSize*4 {
+		return r.Flush(ctx, w)
+	}
+
+	return nil
+}
+
+// Flush inserts the rejected lines batched into the transaction of w, and flushes the file.
+func (r *Rejects) Flush(ctx context.Context, w *BatchWriter) error {
+	return r.flush(func(query string, args ...interface{}) error {
+		return w.Exec(ctx, query, args...)
+	})
+}
+
+// Save inserts the rejected lines batched in the transaction, and flushes the file, as the BatchWriter.BeforeCommit,
+// so that the rejected lines are committed together with the records and the checkpoints after them.
+func (r *Rejects) Save(tx *sql.Tx) error {
+	return r.flush(func(query string, args ...interface{}) error {
+		_, err := tx.Exec(query, args...)
+		return err
+	})
+}
+
+func (r *Rejects) flush(exec func(query string, args ...interface{}) error) error {
+	if r.out != nil {
+		if err := r.out.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(r.batch) == 0 {
+		return nil
+	}
+
+	if err := exec(r.t.CreateInsertSQL(r.d, ConflictPlain, len(r.batch)/4), r.batch...); err != nil {
+		return fmt.Errorf("insert %d rejected lines into %s: %w", len(r.batch)/4, r.t.Name, err)
+	}
+
+	r.batch = r.batch[:0]
+
+	return nil
+}
+
+// Close flushes and closes the file.
+func (r *Rejects) Close() error {
+	if r.file == nil {
+		return nil
+	}
+
+	if err := r.out.Flush(); err != nil {
+		return err
+	}
+
+	return r.file.Close()
+}
+
+// countPrefix counts the line by its prefix of the first line, with the digits replaced by 0,
+// so that the lines differed only by the times and numbers are counted together.
+func (r *Rejects) countPrefix(line string) {
+	if i := strings.IndexByte(line, '\n'); i >= 0 {
+		line = line[:i]
+	}
+
+	prefix := []rune(line)
+	if len(prefix) > rejectPrefixLen {
+		prefix = prefix[:rejectPrefixLen]
+	}
+
+	for i, c := range prefix {
+		if c >= '0' && c <= '9' {
+			prefix[i] = '0'
+		}
+	}
+
+	key := strings.TrimRight(string(prefix), " \t\r")
+	if _, ok := r.prefixes[key]; !ok && len(r.prefixes) >= rejectMaxPrefixes {
+		key = "(other)"
+	}
+
+	r.prefixes[key]++
+}
+
+// LogSummary logs the matched records and the rejected lines, with the top n prefixes of the rejected lines.
+func (r *Rejects) LogSummary(records, lines int64, n int) {
+	percent := 0.0
+	if lines > 0 {
+		percent = 100 * float64(r.Lines) / float64(lines)
+	}
+
+	log.Printf("%d records matched, %d of %d lines(%.2f%%) rejected, %d incomplete records",
+		records, r.Lines, lines, percent, r.Incomplete)
+
+	if r.Lines == 0 {
+		return
+	}
+
+	type prefixCount struct {
+		prefix string
+		count  int64
+	}
+
+	counts := make([]prefixCount, 0, len(r.prefixes))
+	for p, c := range r.prefixes {
+		counts = append(counts, prefixCount{prefix: p, count: c})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+
+		return counts[i].prefix < counts[j].prefix
+	})
+
+	if len(counts) > n {
+		counts = counts[:n]
+	}
+
+	log.Printf("Top %d prefixes of the rejected lines(digits as 0):", len(counts))
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "lines\t%\tprefix")
+
+	for _, c := range counts {
+		_, _ = fmt.Fprintf(w, "%d\t%.2f\t%s\n", c.count, 100*float64(c.count)/float64(r.Lines), c.prefix)
+	}
+
+	_ = w.Flush()
+}
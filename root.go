@@ -14,9 +14,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/m1ome/randstr"
-	"github.com/valyala/fastrand"
-
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -28,6 +25,7 @@ var (
 	driverName string
 	dbPath     string
 	table      string
+	schema     string
 
 	// rootCmd represents the base command when called without any subcommands
 	rootCmd = &cobra.Command{
@@ -74,8 +72,13 @@ func init() {
 
 	p := rootCmd.PersistentFlags()
 	p.StringVarP(&cfgFile, "config", "c", "", "config file (default is $HOME/.sqlite3perf.yaml)")
-	p.StringVar(&driverName, "driver", "sqlite3", "driver name, eg. sqlite3/mysql/sqlite(gitlab.com/cznic/sqlite)")
+	p.StringVar(&driverName, "driver", "sqlite3", "driver name, eg. sqlite3/mysql/sqlite(gitlab.com/cznic/sqlite)/pgx(PostgreSQL)")
 	p.StringVar(&table, "table", "bench", "table name(bench/ff)")
+	p.StringVar(&schema, "schema", "default",
+		"schema variant of the table(default/rowid/autoincrement/without-rowid/strict)")
+	dbOptions.initFlags(p)
+	p.StringArrayVar(&initStatements, "init", nil,
+		"statement run on every new connection, can be repeated, e.g. --init 'PRAGMA cache_size=-64000'")
 	p.StringVar(&dbPath, "db", "./db_"+time.Now().Format(`02_15_04`)+".db?_journal=wal&_sync=0", "path to database")
 }
 
@@ -105,88 +108,194 @@ func initConfig() {
 	}
 }
 
-// Table defines the structure of preference table information.
-type Table struct {
-	InsertFieldsNum int
-	DropSQL         string
-	CreateSQL       string
-	Generator       func(i int) []interface{}
-	CreateInsertSQL func(batchSize int) string
-}
-
-var tables = map[string]Table{
-	"bench": {
-		DropSQL:         `DROP TABLE IF EXISTS bench`,
-		CreateSQL:       `CREATE TABLE bench(ID int PRIMARY KEY, rand varchar(100), hash varchar(100))`,
-		InsertFieldsNum: 3,
-		Generator:       NewHasher().Generator,
-		CreateInsertSQL: func(batchSize int) string {
-			return "INSERT INTO bench(ID, rand, hash) VALUES" + strings.Repeat(",(?,?,?)", batchSize)[1:]
-		},
-	},
-
-	"ff": {
-		DropSQL: `DROP TABLE IF EXISTS ff`,
-		CreateSQL: `CREATE TABLE ff (
-		  id bigint(20) NOT NULL AUTO_INCREMENT,
-		  f01 varchar(255), f02 varchar(255), f03 varchar(255), f04 varchar(255), f05 varchar(255),
-		  f06 varchar(255), f07 varchar(255), f08 varchar(255), f09 varchar(255), f10 varchar(255),
-		  f11 varchar(255), f12 varchar(255), f13 varchar(255), f14 varchar(255), f15 varchar(255),
-		  f16 varchar(255), f17 varchar(255), f18 varchar(255),
-		  created datetime NOT NULL COMMENT '创建时间',
-		  updated datetime NOT NULL COMMENT '更新时间',
-		  PRIMARY KEY (id)
-		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COMMENT = '测试批量插入表'`,
-		InsertFieldsNum: 20,
-		Generator: func(i int) []interface{} {
-			vars := make([]interface{}, 20)
-			for i := 0; i < 18; i++ {
-				vars[i] = randstr.GetString(int(fastrand.Uint32n(250) + 5))
-			}
-			vars[18], vars[19] = time.Now(), time.Now()
-			return vars
-		},
-		CreateInsertSQL: func(batchSize int) string {
-			return "INSERT INTO ff(f01, f02, f03, f04, f05, f06, f07, f08, f09, f10, " +
-				"f11, f12, f13, f14, f15, f16, f17, f18, created, updated) VALUES" +
-				strings.Repeat(",(?,?,?,?,?, ?,?,?,?,?, ?,?,?,?,?, ?,?,?,?,?)", batchSize)[1:]
-		},
-	},
-}
-
-func setupBench(clear bool, maxOpenConns int) *sql.DB {
+// setupBench opens the database, and (re-)creates the table if clear, with the createPragmas like
+// auto_vacuum=INCREMENTAL set before, which only take effect when set before the first table is created.
+func setupBench(clear bool, maxOpenConns int, createPragmas ...string) *sql.DB {
+	db := openDB(dbPath, maxOpenConns)
+
+	if clear {
+		t, ok := tables[table]
+		if !ok {
+			log.Fatalf("%s does not exist", table)
+		}
+
+		// Validated before the drop, not to drop the table and then fail to create it.
+		d := DriverDialect(driverName)
+
+		createSQL, err := t.CreateSQL(d, schema)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := CheckSchema(db, d, schema); err != nil {
+			log.Fatal(err)
+		}
+
+		log.Print("Dropping table", table, "if already present")
+
+		if _, err := db.Exec(t.DropSQL()); err != nil {
+			log.Fatalf("Could not delete table '%s' for (re-)generation of data: %s", table, err)
+		}
+
+		createPragmas = append(dbOptions.CreatePragmas(), createPragmas...)
+		createTable(db, createSQL, createPragmas)
+
+		log.Print("Setting up the environment")
+	}
+
+	return db
+}
+
+// openDB opens the database of path with the options translated into the DSN form of the driver,
+// runs the ones not supported by the DSN and the --init statements on every new connection,
+// and verifies they took effect.
+func openDB(path string, maxOpenConns int) *sql.DB {
+	dsn, pragmas, afterOpen, err := dbOptions.DSN(driverName, path)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	log.Print("Opening database")
-	db, err := sql.Open(driverName, dbPath)
+	if dsn != path {
+		log.Printf("DSN translated for driver %s: %s", driverName, dsn)
+	}
+
+	statements := connInitStatements(afterOpen)
+	if len(statements) > 0 {
+		log.Printf("Statements run on every new connection: %v", statements)
+	}
+
+	db, err := openWithInit(driverName, dsn, statements)
 	if err != nil {
-		log.Fatalf("Error while opening database '%s': %s", dbPath, err.Error())
+		log.Fatalf("Error while opening database '%s': %s", path, err.Error())
 	}
 
 	if maxOpenConns > 0 {
 		db.SetMaxOpenConns(maxOpenConns)
 	}
 
-	if clear {
-		log.Print("Dropping table", table, "if already present")
+	if mismatched := verifyPragmas(db, pragmas); len(mismatched) > 0 {
+		log.Printf("PRAGMA %v did not take effect", mismatched)
+	}
 
-		t, ok := tables[table]
-		if !ok {
-			log.Fatalf("%s does not exist", table)
+	log.Printf("Environment: %s", CollectEnvironment(db))
+
+	return db
+}
+
+// pragmaConn is the common of *sql.DB and *sql.Conn to run the PRAGMAs on.
+type pragmaConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// createTable creates the table with the createPragmas set before on a pinned connection.
+// The page_size can not be changed in WAL mode, even by VACUUM, so the journal mode is switched
+// to DELETE around and restored after.
+func createTable(db *sql.DB, createSQL string, createPragmas []string) {
+	ctx := context.Background()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		log.Fatalf("Could not get connection: %v", err)
+	}
+	defer conn.Close()
+
+	journalMode := ""
+	if hasPragma(createPragmas, "page_size") && DriverDialect(driverName) == SQLite {
+		if journalMode, err = QueryPragmaValue(conn, "journal_mode"); err != nil {
+			log.Fatalf("PRAGMA journal_mode error: %v", err)
 		}
 
-		if _, err := db.Exec(t.DropSQL); err != nil {
-			log.Fatalf("Could not delete table 'bench' for (re-)generation of data: %s", err)
+		if strings.EqualFold(journalMode, "wal") {
+			log.Print("Switching journal_mode from WAL to DELETE to set page_size")
+			setPragmas(conn, []string{"journal_mode=DELETE"})
+		} else {
+			journalMode = ""
 		}
+	}
+
+	setPragmas(conn, createPragmas)
 
-		log.Print("(Re-)creating table", table)
+	log.Printf("(Re-)creating table %s with schema %s", table, schema)
+
+	if _, err := conn.ExecContext(ctx, createSQL); err != nil {
+		log.Fatalf("Could not create table %s: %s", table, err)
+	}
 
-		if _, err := db.Exec(t.CreateSQL); err != nil {
-			log.Fatalf("Could not create table %s: %s", table, err)
+	verifyCreatePragmas(conn, createPragmas)
+
+	if journalMode != "" {
+		log.Printf("Restoring journal_mode to %s", journalMode)
+		setPragmas(conn, []string{"journal_mode=" + journalMode})
+	}
+}
+
+func hasPragma(pragmas []string, name string) bool {
+	for _, p := range pragmas {
+		if n, _ := splitPragma(p); strings.EqualFold(n, name) {
+			return true
 		}
+	}
 
-		log.Print("Setting up the environment")
+	return false
+}
+
+func setPragmas(db pragmaConn, pragmas []string) {
+	if d := DriverDialect(driverName); len(pragmas) > 0 && d != SQLite {
+		log.Fatalf("PRAGMA %v are only supported by %s, not %s", pragmas, SQLite, d)
 	}
 
-	return db
+	for _, p := range pragmas {
+		if _, err := ParsePragma(p, false); err != nil {
+			log.Fatal(err)
+		}
+
+		if _, err := db.ExecContext(context.Background(), "PRAGMA "+p); err != nil {
+			log.Fatalf("PRAGMA %s error: %v", p, err)
+		}
+	}
+}
+
+// verifyCreatePragmas verifies the createPragmas took effect. If not, e.g. auto_vacuum could not be changed
+// on a database with tables, a VACUUM is run to rebuild the database file with them.
+func verifyCreatePragmas(db pragmaConn, pragmas []string) {
+	for vacuumed := false; ; vacuumed = true {
+		mismatched := verifyPragmas(db, pragmas)
+		if len(mismatched) == 0 {
+			return
+		}
+
+		if vacuumed {
+			log.Printf("PRAGMA %v did not take effect even after VACUUM", mismatched)
+			return
+		}
+
+		log.Printf("PRAGMA %v did not take effect on the existing database file, VACUUM to apply", mismatched)
+
+		if _, err := db.ExecContext(context.Background(), "VACUUM"); err != nil {
+			log.Fatalf("VACUUM error: %v", err)
+		}
+	}
+}
+
+// verifyPragmas verifies the pragmas took effect, and returns the mismatched ones.
+func verifyPragmas(db pragmaConn, pragmas []string) (mismatched []string) {
+	for _, p := range pragmas {
+		name, value := splitPragma(p)
+		got, err := QueryPragmaValue(db, name)
+		if err != nil {
+			log.Fatalf("PRAGMA %s error: %v", name, err)
+		}
+
+		if PragmaValueEquals(name, value, got) {
+			log.Printf("PRAGMA %s=%s took effect", name, got)
+		} else {
+			mismatched = append(mismatched, fmt.Sprintf("%s=%s(want %s)", name, got, value))
+		}
+	}
+
+	return mismatched
 }
 
 // Hasher is a structure to generate a random string with its hash value.
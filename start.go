@@ -0,0 +1,159 @@
+package sqlite3perf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// StartAuto is the --start to detect the record start from the head of the input.
+const StartAuto = "auto"
+
+// The record start detected should match at least minStartLines lines and minStartShare of the lines sampled,
+// not to take a spurious match for the start of a record growing over the whole file.
+const (
+	minStartLines = 2
+	minStartShare = 0.1
+)
+
+// RecordStart is the rule of the lines starting the records, a record per line if empty.
+type RecordStart struct {
+	// Sample is the sample of the line start, whose digits match any digits, like 2021/05/29 13:09:46.
+	Sample string
+	// Regex matches the lines starting the records, at the starts of the lines.
+	Regex *regexp.Regexp
+	// Name names the rule detected.
+	Name string
+}
+
+// startCandidate is a candidate of the record start detected.
+type startCandidate struct {
+	name string
+	expr string
+}
+
+// startCandidates are the candidates of the record start, in the order of preference for the same matched lines.
+// nolint:gochecknoglobals
+var startCandidates = []startCandidate{
+	{"ISO 8601 timestamp", `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}`},
+	{"Go log timestamp", `\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}`},
+	{"bracketed timestamp", `\[\d{4}[-/]\d{2}[-/]\d{2}[T ]\d{2}:\d{2}:\d{2}`},
+	{"syslog timestamp", `(?:<\d{1,3}>)?[A-Z][a-z]{2} [ \d]\d \d{2}:\d{2}:\d{2}`},
+	{"syslog priority", `<\d{1,3}>\d? ?\S`},
+	{"glog header", `[IWEF]\d{4} \d{2}:\d{2}:\d{2}`},
+	{"access log time", `\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2}`},
+	{"time of day", `\d{2}:\d{2}:\d{2}`},
+	{"unix epoch", `\d{10}(?:\.\d+)?\b`},
+	{"log level", `\[?(?i:trace|debug|info|warn|warning|error|fatal|panic|critical)\]?[\s:]`},
+}
+
+// NewRecordStart creates the record start of the regular expression matched at the starts of the lines.
+func NewRecordStart(expr, name string) (RecordStart, error) {
+	re, err := regexp.Compile(`\A(?:` + expr + `)`)
+	if err != nil {
+		return RecordStart{}, fmt.Errorf("record start regex %s: %w", expr, err)
+	}
+
+	return RecordStart{Regex: re, Name: name}, nil
+}
+
+// DetectRecordStart detects the record start by the lines of the sample, started by the candidate matching
+// the most lines, or a record per line if it matched too few lines.
+func DetectRecordStart(sample []byte) (start RecordStart, matched, lines int) {
+	// The last line may be cut by the sample.
+	if i := bytes.LastIndexByte(sample, '\n'); i >= 0 {
+		sample = sample[:i]
+	}
+
+	var sampled [][]byte
+
+	for _, line := range bytes.Split(sample, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) > 0 {
+			sampled = append(sampled, line)
+		}
+	}
+
+	for _, c := range startCandidates {
+		re := regexp.MustCompile(`\A(?:` + c.expr + `)`)
+		n := 0
+
+		for _, line := range sampled {
+			if re.Match(line) {
+				n++
+			}
+		}
+
+		if n > matched {
+			matched, start = n, RecordStart{Regex: re, Name: c.name}
+		}
+	}
+
+	if matched < minStartLines || float64(matched) < minStartShare*float64(len(sampled)) {
+		start = RecordStart{}
+	}
+
+	return start, matched, len(sampled)
+}
+
+// Split returns the split function of the records.
+func (s RecordStart) Split() bufio.SplitFunc {
+	switch {
+	case s.Regex != nil:
+		return func(data []byte, atEOF bool) (int, []byte, error) { return scanStarts(s.Regex, data, atEOF) }
+	case s.Sample != "":
+		return NewScanLines(s.Sample)
+	default:
+		return bufio.ScanLines
+	}
+}
+
+func (s RecordStart) String() string {
+	switch {
+	case s.Regex != nil && s.Name != "":
+		return fmt.Sprintf("%s %s", s.Name, s.Regex)
+	case s.Regex != nil:
+		return s.Regex.String()
+	case s.Sample != "":
+		return fmt.Sprintf("sample %q as %s", s.Sample, convertDigits(s.Sample))
+	default:
+		return "none, a record per line"
+	}
+}
+
+// scanStarts splits the records, each of which starts at a line matched by the start regex,
+// with the lines not matched after it. The lines before the first start are a record too.
+func scanStarts(start *regexp.Regexp, data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	for i := 0; ; {
+		j := bytes.IndexByte(data[i:], '\n')
+		if j < 0 {
+			break
+		}
+
+		i += j + 1
+
+		// The line is matched only when complete, the regex may match more than its prefix.
+		end := bytes.IndexByte(data[i:], '\n')
+		if end < 0 && !atEOF {
+			break
+		}
+
+		if end < 0 {
+			end = len(data) - i
+		}
+
+		if start.Match(data[i : i+end]) {
+			return i, data[:i], nil
+		}
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
@@ -0,0 +1,146 @@
+package sqlite3perf
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectRecordStart(t *testing.T) {
+	tests := []struct {
+		name          string
+		sample        string
+		want          string
+		matched, line int
+	}{
+		{
+			name: "go log with continuation lines",
+			sample: "2021/05/29 13:09:46 Replay POST\n" +
+				"Title: ### REQUEST #1\n" +
+				"2021/05/29 13:09:47 Replay GET\n" +
+				"Title: ### REQUEST #2\n",
+			want: "Go log timestamp", matched: 2, line: 4,
+		},
+		{
+			name: "java stack trace",
+			sample: "2021-05-29 13:09:46.123 ERROR failed\n" +
+				"java.lang.IllegalStateException: boom\n" +
+				"\tat a.b.C.d(C.java:10)\n" +
+				"2021-05-29 13:09:47.456 INFO ok\n",
+			want: "ISO 8601 timestamp", matched: 2, line: 4,
+		},
+		{
+			name:   "syslog preferred over time of day",
+			sample: "May 29 13:09:46 host app[1]: a\nMay 29 13:09:47 host app[1]: b\n",
+			want:   "syslog timestamp", matched: 2, line: 2,
+		},
+		{
+			name:   "access log",
+			sample: `127.0.0.1 - - [29/May/2021:13:09:46 +0000] "GET / HTTP/1.1" 200 1` + "\n",
+			want:   "", matched: 0, line: 1,
+		},
+		{
+			name:   "last line cut by the sample",
+			sample: "I0529 13:09:46.123 main.go:10] a\n\nI0529 13:09:47.456 main.go:11] b\nI0529 13:",
+			want:   "glog header", matched: 2, line: 2,
+		},
+		{
+			name:   "single line matched",
+			sample: "hello\n2021-05-29 13:09:46 a\nworld\n",
+			want:   "", matched: 1, line: 3,
+		},
+		{
+			name: "too few lines matched",
+			sample: "2021-05-29 13:09:46 a\n" + strings.Repeat("at b\n", 9) +
+				"2021-05-29 13:09:47 c\n" + strings.Repeat("at d\n", 11),
+			want: "", matched: 2, line: 22,
+		},
+		{
+			name: "a tenth of the lines matched",
+			sample: "2021-05-29 13:09:46 a\n" + strings.Repeat("at b\n", 9) +
+				"2021-05-29 13:09:47 c\n" + strings.Repeat("at d\n", 9),
+			want: "ISO 8601 timestamp", matched: 2, line: 20,
+		},
+		{
+			name:   "no start",
+			sample: "hello\nworld\n",
+			want:   "", matched: 0, line: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, matched, lines := DetectRecordStart([]byte(tt.sample))
+			if start.Name != tt.want || matched != tt.matched || lines != tt.line {
+				t.Errorf("DetectRecordStart() = %s, %d of %d lines, want %s, %d of %d lines",
+					start, matched, lines, tt.want, tt.matched, tt.line)
+			}
+
+			if tt.want == "" && start.Regex != nil {
+				t.Errorf("DetectRecordStart() = %s, want a record per line", start)
+			}
+		})
+	}
+}
+
+func TestRecordStartSplit(t *testing.T) {
+	isoStart, err := NewRecordStart(`\d{4}-\d{2}-\d{2}`, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		start RecordStart
+		input string
+		want  []string
+	}{
+		{
+			name: "a record per line", input: "a\nb\n\nc",
+			want: []string{"a", "b", "", "c"},
+		},
+		{
+			name: "regex", start: isoStart,
+			input: "head\n2021-05-29 a\n  at b\n  at c\n2021-05-30 d\n2021-05-31 e",
+			want:  []string{"head\n", "2021-05-29 a\n  at b\n  at c\n", "2021-05-30 d\n", "2021-05-31 e"},
+		},
+		{
+			name: "regex only at the line starts", start: isoStart,
+			input: "2021-05-29 a 2021-05-30\n2021-05-31 b\n",
+			want:  []string{"2021-05-29 a 2021-05-30\n", "2021-05-31 b\n"},
+		},
+		{
+			name: "sample", start: RecordStart{Sample: "2021/05/29 13:09:46"},
+			input: "2021/05/29 13:09:46 a\nb\n2021/05/29 13:09:47 c\n",
+			want:  []string{"2021/05/29 13:09:46 a\nb\n", "2021/05/29 13:09:47 c\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := bufio.NewScanner(strings.NewReader(tt.input))
+			scanner.Buffer(make([]byte, 8), 1024) // the small buffer splits across the reads.
+			scanner.Split(tt.start.Split())
+
+			var got []string
+			for scanner.Scan() {
+				got = append(got, scanner.Text())
+			}
+
+			if err := scanner.Err(); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Split() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRecordStartInvalid(t *testing.T) {
+	if _, err := NewRecordStart(`(\d`, ""); err == nil {
+		t.Error("NewRecordStart() of an invalid regex, want error")
+	}
+}
@@ -0,0 +1,263 @@
+package sqlite3perf
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// SweepCmd is the struct representing sweep sub-command.
+type SweepCmd struct {
+	PageSizes  []int
+	CacheSizes []int
+	MmapSizes  []int64
+	TempStores []string
+	// Bench runs the bench command after each generation to measure the scan speed, only for the bench table.
+	Bench bool
+	// Keep keeps the database files of the runs.
+	Keep bool
+	// Out is the JSON lines file to append the results of the runs.
+	Out string
+
+	generate GenerateCmd
+}
+
+// SweepResult is the result of a single run of the sweep.
+type SweepResult struct {
+	Time          time.Time     `json:"time"`
+	DB            string        `json:"db"`
+	Table         string        `json:"table"`
+	Options       DBOptions     `json:"options"`
+	Records       int           `json:"records"`
+	BatchSize     int           `json:"batchSize"`
+	Prepared      bool          `json:"prepared"`
+	InsertElapsed time.Duration `json:"insertElapsed"`
+	InsertsPerSec float64       `json:"insertsPerSec"`
+	ScanRows      int64         `json:"scanRows,omitempty"`
+	ScanElapsed   time.Duration `json:"scanElapsed,omitempty"`
+	ScansPerSec   float64       `json:"scansPerSec,omitempty"`
+	FileSize      int64         `json:"fileSize"`
+	// PageSize is the effective page_size read back from the database file.
+	PageSize int         `json:"pageSize"`
+	Env      Environment `json:"env"`
+	// Error is the error of the run, like the page_size requested not took effect.
+	Error string `json:"error,omitempty"`
+}
+
+// nolint:gochecknoinits
+func init() {
+	c := SweepCmd{}
+	cmd := &cobra.Command{
+		Use:   "sweep",
+		Short: "sweep page size, cache size, mmap size and temp store with generate",
+		Long: `This command runs the "generate" command (and optionally "bench") on a new database file
+for each combination of the swept page sizes, cache sizes, mmap sizes and temp stores,
+and records the results of each run.
+
+e.g. sqlite3perf sweep --page-sizes 1024,4096,16384 --cache-sizes -2000,-64000 -r 100000 -b 1000 -p --bench
+`,
+		Run: c.run,
+	}
+
+	rootCmd.AddCommand(cmd)
+	c.initFlags(cmd.Flags())
+}
+
+func (g *SweepCmd) initFlags(f *pflag.FlagSet) {
+	g.generate.initFlags(f)
+	f.IntSliceVar(&g.PageSizes, "page-sizes", nil, "page sizes to sweep, default --page-size")
+	f.IntSliceVar(&g.CacheSizes, "cache-sizes", nil, "cache sizes to sweep, default --cache-size")
+	f.Int64SliceVar(&g.MmapSizes, "mmap-sizes", nil, "mmap sizes to sweep, default --mmap-size")
+	f.StringSliceVar(&g.TempStores, "temp-stores", nil, "temp stores to sweep, default --temp-store")
+	f.BoolVar(&g.Bench, "bench", false, "run bench after each generation to measure the scan speed(bench table only)")
+	f.BoolVar(&g.Keep, "keep", false, "keep the database files of the runs")
+	f.StringVar(&g.Out, "out", "", "JSON lines file to append the results of the runs")
+}
+
+func (g *SweepCmd) run(cmd *cobra.Command, args []string) {
+	if d := DriverDialect(driverName); d != SQLite {
+		log.Fatalf("sweep is only supported by %s, not %s", SQLite, d)
+	}
+
+	combinations := g.combinations()
+	log.Printf("Sweeping %d combinations", len(combinations))
+
+	var out *json.Encoder
+	if g.Out != "" {
+		f, err := os.OpenFile(g.Out, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("open %s error: %v", g.Out, err)
+		}
+		defer f.Close()
+
+		out = json.NewEncoder(f)
+	}
+
+	base := dbPath
+	results := make([]SweepResult, 0, len(combinations))
+
+	for i, o := range combinations {
+		dbOptions, dbPath = o, sweepDBPath(base, i)
+		log.Printf("Sweep %d/%d: %s on %s", i+1, len(combinations), o, dbPath)
+
+		r := g.runOnce()
+		results = append(results, r)
+
+		if out != nil {
+			if err := out.Encode(r); err != nil {
+				log.Fatalf("write %s error: %v", g.Out, err)
+			}
+		}
+	}
+
+	printSweepResults(results)
+}
+
+func (g *SweepCmd) runOnce() SweepResult {
+	file := dbFile()
+	removeDBFiles(file)
+
+	if !g.Keep {
+		defer removeDBFiles(file)
+	}
+
+	gen := g.generate
+	elapsed := gen.Run()
+
+	r := SweepResult{
+		Time:          time.Now(),
+		DB:            dbPath,
+		Table:         table,
+		Options:       dbOptions,
+		Records:       gen.NumRecs,
+		BatchSize:     gen.BatchSize,
+		Prepared:      gen.Prepared,
+		InsertElapsed: elapsed,
+	}
+
+	if elapsed > 0 {
+		r.InsertsPerSec = float64(gen.NumRecs) / elapsed.Seconds()
+	}
+
+	db := setupBench(false, 0)
+	defer db.Close()
+
+	r.Env = CollectEnvironment(db)
+
+	if v, err := QueryPragmaValue(db, "page_size"); err != nil {
+		log.Fatalf("PRAGMA page_size error: %v", err)
+	} else if r.PageSize, err = strconv.Atoi(v); err != nil {
+		log.Fatalf("PRAGMA page_size %s error: %v", v, err)
+	}
+
+	if p := dbOptions.PageSize; p > 0 && r.PageSize != p {
+		r.Error = fmt.Sprintf("page_size %d, want %d", r.PageSize, p)
+		log.Printf("Sweep failed: %s", r.Error)
+
+		return r
+	}
+
+	if g.Bench && table == "bench" {
+		r.ScanRows, r.ScanElapsed = runBench(db)
+		if r.ScanElapsed > 0 {
+			r.ScansPerSec = float64(r.ScanRows) / r.ScanElapsed.Seconds()
+		}
+	}
+
+	if fi, err := os.Stat(file); err == nil {
+		r.FileSize = fi.Size()
+	}
+
+	return r
+}
+
+// combinations returns the cartesian product of the swept options,
+// the unswept ones are from the global options.
+func (g *SweepCmd) combinations() []DBOptions {
+	pageSizes := g.PageSizes
+	if len(pageSizes) == 0 {
+		pageSizes = []int{dbOptions.PageSize}
+	}
+
+	cacheSizes := g.CacheSizes
+	if len(cacheSizes) == 0 {
+		cacheSizes = []int{dbOptions.CacheSize}
+	}
+
+	mmapSizes := g.MmapSizes
+	if len(mmapSizes) == 0 {
+		mmapSizes = []int64{dbOptions.MmapSize}
+	}
+
+	tempStores := g.TempStores
+	if len(tempStores) == 0 {
+		tempStores = []string{dbOptions.TempStore}
+	}
+
+	var combinations []DBOptions
+
+	for _, p := range pageSizes {
+		for _, c := range cacheSizes {
+			for _, m := range mmapSizes {
+				for _, t := range tempStores {
+					o := dbOptions
+					o.PageSize, o.CacheSize, o.MmapSize, o.TempStore = p, c, m, t
+					combinations = append(combinations, o)
+				}
+			}
+		}
+	}
+
+	return combinations
+}
+
+// sweepDBPath returns the database path of the i-th run, e.g. a.db?_journal=wal to a-sweep1.db?_journal=wal.
+func sweepDBPath(base string, i int) string {
+	return suffixDBPath(base, fmt.Sprintf("-sweep%d", i+1))
+}
+
+// suffixDBPath appends the suffix to the file name of the database path, before the extension and the query.
+func suffixDBPath(base, suffix string) string {
+	file, query := base, ""
+	if p := strings.IndexByte(base, '?'); p >= 0 {
+		file, query = base[:p], base[p:]
+	}
+
+	ext := filepath.Ext(file)
+
+	return strings.TrimSuffix(file, ext) + suffix + ext + query
+}
+
+func removeDBFiles(file string) {
+	if file == "" {
+		return
+	}
+
+	for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+		if err := os.Remove(file + suffix); err != nil && !os.IsNotExist(err) {
+			log.Printf("remove %s error: %v", file+suffix, err)
+		}
+	}
+}
+
+func printSweepResults(results []SweepResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintln(w, "#\tpage_size\tcache_size\tmmap_size\ttemp_store\tinserts/s\tscans/s\tfile size\terror\t")
+
+	for i, r := range results {
+		_, _ = fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%s\t%.2f\t%.2f\t%s\t%s\t\n", i+1,
+			r.PageSize, r.Options.CacheSize, r.Options.MmapSize, r.Options.TempStore,
+			r.InsertsPerSec, r.ScansPerSec, humanBytes(r.FileSize), r.Error)
+	}
+
+	_ = w.Flush()
+}
@@ -0,0 +1,296 @@
+package sqlite3perf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m1ome/randstr"
+	"github.com/valyala/fastrand"
+)
+
+// ColumnType is the portable type of a table column, mapped to a concrete type by each Dialect.
+type ColumnType int
+
+const (
+	// TypeInt is a 32-bit integer.
+	TypeInt ColumnType = iota
+	// TypeBigInt is a 64-bit integer.
+	TypeBigInt
+	// TypeVarchar is a variable length string of at most Column.Size characters.
+	TypeVarchar
+	// TypeDatetime is a date with time.
+	TypeDatetime
+	// TypeReal is a double precision floating point number.
+	TypeReal
+	// TypeText is a string of unlimited length.
+	TypeText
+)
+
+// Column defines a column of a Table.
+type Column struct {
+	Name string
+	Type ColumnType
+	// Size is the max length of TypeVarchar.
+	Size       int
+	PrimaryKey bool
+	// AutoIncrement columns are assigned by the database, and so not inserted.
+	AutoIncrement bool
+	NotNull       bool
+	Comment       string
+}
+
+// Table defines the structure of preference table information.
+type Table struct {
+	Name    string
+	Comment string
+	Columns []Column
+	// Generator generates the values of the InsertColumns for the i-th record.
+	Generator func(i int) []interface{}
+}
+
+// Schema variants of the --schema flag, only the default one is available for dialects other than SQLite.
+const (
+	// SchemaDefault maps the columns by their declared types, e.g. ID int PRIMARY KEY,
+	// which in SQLite is not an alias of the rowid and builds a separate index.
+	SchemaDefault = "default"
+	// SchemaRowid makes the integer primary key an alias of the rowid.
+	SchemaRowid = "rowid"
+	// SchemaAutoincrement is SchemaRowid with the AUTOINCREMENT keyword.
+	SchemaAutoincrement = "autoincrement"
+	// SchemaWithoutRowid creates a WITHOUT ROWID table.
+	SchemaWithoutRowid = "without-rowid"
+	// SchemaStrict creates a STRICT table, requires SQLite 3.37.0+.
+	SchemaStrict = "strict"
+)
+
+// InsertColumns returns the columns inserted by the client, that are all except the AutoIncrement ones.
+func (t Table) InsertColumns() []Column {
+	cols := make([]Column, 0, len(t.Columns))
+	for _, c := range t.Columns {
+		if !c.AutoIncrement {
+			cols = append(cols, c)
+		}
+	}
+
+	return cols
+}
+
+// InsertFieldsNum returns the number of values of a single inserted record.
+func (t Table) InsertFieldsNum() int { return len(t.InsertColumns()) }
+
+// DropSQL returns the DROP TABLE statement.
+func (t Table) DropSQL() string { return `DROP TABLE IF EXISTS ` + t.Name }
+
+// KeyColumn returns the primary key column.
+func (t Table) KeyColumn() (Column, bool) {
+	for _, c := range t.Columns {
+		if c.PrimaryKey {
+			return c, true
+		}
+	}
+
+	return Column{}, false
+}
+
+// CreateInsertSQL returns the INSERT statement of batchSize records in the dialect with the conflict mode.
+func (t Table) CreateInsertSQL(d Dialect, conflict string, batchSize int) string {
+	cols := t.InsertColumns()
+	names := make([]string, len(cols))
+	for i, c := range cols {
+		names[i] = c.Name
+	}
+
+	var keys []string
+	if key, ok := t.KeyColumn(); ok {
+		keys = append(keys, key.Name)
+	}
+
+	return d.InsertSQL(conflict, t.Name, names, keys, batchSize)
+}
+
+// CreateSQL returns the CREATE TABLE statement of the schema variant in the dialect.
+func (t Table) CreateSQL(d Dialect, schema string) (string, error) {
+	if schema == "" {
+		schema = SchemaDefault
+	}
+
+	switch schema {
+	case SchemaDefault:
+	case SchemaRowid, SchemaAutoincrement, SchemaWithoutRowid, SchemaStrict:
+		if d != SQLite {
+			return "", fmt.Errorf("schema %s is only supported by %s, not %s", schema, SQLite, d)
+		}
+	default:
+		return "", fmt.Errorf("unknown schema %s", schema)
+	}
+
+	defs := make([]string, 0, len(t.Columns)+1)
+	var pks []string
+
+	for _, c := range t.Columns {
+		def, err := c.definition(d, schema)
+		if err != nil {
+			return "", fmt.Errorf("table %s: %w", t.Name, err)
+		}
+
+		defs = append(defs, def)
+
+		// SQLite declares the primary key inline to make INTEGER PRIMARY KEY a rowid alias.
+		if c.PrimaryKey && d != SQLite {
+			pks = append(pks, c.Name)
+		}
+	}
+
+	if len(pks) > 0 {
+		defs = append(defs, "PRIMARY KEY ("+strings.Join(pks, ", ")+")")
+	}
+
+	s := "CREATE TABLE " + t.Name + " (\n  " + strings.Join(defs, ",\n  ") + "\n)"
+
+	switch d {
+	case SQLite:
+		switch schema {
+		case SchemaWithoutRowid:
+			s += " WITHOUT ROWID"
+		case SchemaStrict:
+			s += " STRICT"
+		}
+	case MySQL:
+		s += " ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"
+		if t.Comment != "" {
+			s += " COMMENT=" + quote(t.Comment)
+		}
+	}
+
+	return s, nil
+}
+
+func (c Column) definition(d Dialect, schema string) (string, error) {
+	switch d {
+	case SQLite:
+		return c.sqliteDefinition(schema)
+	case MySQL:
+		def := c.Name + " " + c.typeName(d)
+		if c.NotNull || c.PrimaryKey {
+			def += " NOT NULL"
+		}
+		if c.AutoIncrement {
+			def += " AUTO_INCREMENT"
+		}
+		if c.Comment != "" {
+			def += " COMMENT " + quote(c.Comment)
+		}
+		return def, nil
+	default:
+		if c.AutoIncrement {
+			return c.Name + " BIGSERIAL", nil
+		}
+		def := c.Name + " " + c.typeName(d)
+		if c.NotNull {
+			def += " NOT NULL"
+		}
+		return def, nil
+	}
+}
+
+func (c Column) sqliteDefinition(schema string) (string, error) {
+	if c.PrimaryKey {
+		// A database assigned key must be an alias of the rowid, which does not exist in WITHOUT ROWID tables.
+		if c.AutoIncrement && schema == SchemaWithoutRowid {
+			return "", fmt.Errorf("schema %s requires an explicit primary key value for %s", schema, c.Name)
+		}
+
+		switch {
+		case schema == SchemaAutoincrement:
+			return c.Name + " INTEGER PRIMARY KEY AUTOINCREMENT", nil
+		case schema != SchemaDefault || c.AutoIncrement:
+			return c.Name + " INTEGER PRIMARY KEY", nil
+		default:
+			return c.Name + " " + c.typeName(SQLite) + " PRIMARY KEY", nil
+		}
+	}
+
+	typ := c.typeName(SQLite)
+	if schema == SchemaStrict {
+		// STRICT tables only accept INT/INTEGER/REAL/TEXT/BLOB/ANY.
+		switch c.Type {
+		case TypeInt, TypeBigInt:
+			typ = "INTEGER"
+		case TypeReal:
+			typ = "REAL"
+		default:
+			typ = "TEXT"
+		}
+	}
+
+	def := c.Name + " " + typ
+	if c.NotNull {
+		def += " NOT NULL"
+	}
+
+	return def, nil
+}
+
+func (c Column) typeName(d Dialect) string {
+	switch c.Type {
+	case TypeInt:
+		return "int"
+	case TypeBigInt:
+		return "bigint"
+	case TypeVarchar:
+		return "varchar(" + strconv.Itoa(c.Size) + ")"
+	case TypeReal:
+		if d == Postgres {
+			return "double precision"
+		}
+		return "double"
+	case TypeText:
+		return "text"
+	default:
+		if d == Postgres {
+			return "timestamp"
+		}
+		return "datetime"
+	}
+}
+
+func quote(s string) string { return "'" + strings.ReplaceAll(s, "'", "''") + "'" }
+
+var tables = map[string]Table{
+	"bench": {
+		Name: "bench",
+		Columns: []Column{
+			{Name: "ID", Type: TypeInt, PrimaryKey: true},
+			{Name: "rand", Type: TypeVarchar, Size: 100},
+			{Name: "hash", Type: TypeVarchar, Size: 100},
+		},
+		Generator: NewHasher().Generator,
+	},
+
+	"ff": {
+		Name:    "ff",
+		Comment: "测试批量插入表",
+		Columns: ffColumns(),
+		Generator: func(i int) []interface{} {
+			vars := make([]interface{}, 20)
+			for i := 0; i < 18; i++ {
+				vars[i] = randstr.GetString(int(fastrand.Uint32n(250) + 5))
+			}
+			vars[18], vars[19] = time.Now(), time.Now()
+			return vars
+		},
+	},
+}
+
+func ffColumns() []Column {
+	cols := []Column{{Name: "id", Type: TypeBigInt, PrimaryKey: true, AutoIncrement: true}}
+	for i := 1; i <= 18; i++ {
+		cols = append(cols, Column{Name: fmt.Sprintf("f%02d", i), Type: TypeVarchar, Size: 255})
+	}
+
+	return append(cols,
+		Column{Name: "created", Type: TypeDatetime, NotNull: true, Comment: "创建时间"},
+		Column{Name: "updated", Type: TypeDatetime, NotNull: true, Comment: "更新时间"})
+}